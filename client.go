@@ -1,14 +1,85 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/rpc"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// defaultRPCTimeout is how long a command waits for the daemon to answer.
+const defaultRPCTimeout = 3 * time.Second
+
+// defaultSpawnTimeout is how long a client waits for a new daemon to listen.
+const defaultSpawnTimeout = time.Second
+
+// spawnPollInterval is how often the client retries the socket while a new daemon starts.
+const spawnPollInterval = 50 * time.Millisecond
+
+// rpcCaller is the part of *rpc.Client used by commands.
+// It exists so tests can substitute a fake daemon.
+type rpcCaller interface {
+	Go(serviceMethod string, args any, reply any, done chan *rpc.Call) *rpc.Call
+}
+
+// rpcTimeout returns the configured RPC timeout.
+// CNOTE_RPC_TIMEOUT accepts a Go duration such as "500ms" or "10s".
+func rpcTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CNOTE_RPC_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultRPCTimeout
+}
+
+// spawnTimeout returns how long to wait for a spawned daemon.
+// CNOTE_SPAWN_TIMEOUT accepts a Go duration, for machines where 1s is too short.
+func spawnTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CNOTE_SPAWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultSpawnTimeout
+}
+
+// callRPC invokes a daemon method like client.Call, but gives up once the
+// timeout elapses so a hung daemon cannot block the terminal forever.
+func callRPC(client rpcCaller, method string, args any, reply any) error {
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return translateRPCError(call.Error)
+	case <-time.After(rpcTimeout()):
+		return fmt.Errorf("daemon not responding")
+	}
+}
+
+// translateRPCError rewrites net/rpc's "can't find method" error, which means
+// the running daemon predates this client, into actionable advice.
+func translateRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if strings.HasPrefix(msg, "rpc: can't find method ") || strings.HasPrefix(msg, "rpc: can't find service ") {
+		method := msg[strings.LastIndex(msg, " ")+1:]
+		return fmt.Errorf("your daemon is outdated and does not support %s; run 'cnote clear --stop' to restart it (this deletes all notes)", method)
+	}
+	return err
+}
+
+// noSpawn is set by the global --no-spawn flag. It stops every command,
+// including add, from starting a daemon when none is running.
+var noSpawn bool
+
 // getClient attempts to connect to the running daemon via Unix Socket.
 // if autoStart is true, it spawns the daemon process if it isn't running.
 func getClient(autoStart bool) (*rpc.Client, error) {
@@ -22,6 +93,9 @@ func getClient(autoStart bool) (*rpc.Client, error) {
 	if !autoStart {
 		return nil, fmt.Errorf("no active session. Start one with 'cnote add'")
 	}
+	if noSpawn {
+		return nil, fmt.Errorf("no active session (--no-spawn prevents starting one)")
+	}
 
 	// 3. Spawn the Daemon
 	// We call the same binary with the hidden "daemon" command.
@@ -31,18 +105,274 @@ func getClient(autoStart bool) (*rpc.Client, error) {
 	// If we don't do this, closing the terminal kills the daemon.
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 
+	// Capture stderr so a daemon that fails to start can explain why
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
 	err = cmd.Start()
 	if err != nil {
 		return nil, fmt.Errorf("failed to start daemon: %v", err)
 	}
 
-	// 4. Wait loop: Wait for the socket file to appear (max 1 second)
-	for i := 0; i < 20; i++ {
-		time.Sleep(50 * time.Millisecond)
-		client, err = rpc.Dial("unix", SocketPath)
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	// 4. Wait loop: Wait for the socket to accept connections
+	dial := func() (*rpc.Client, error) { return rpc.Dial("unix", SocketPath) }
+	client, err = waitForDaemon(dial, exited, spawnPollInterval, spawnTimeout())
+	if err == errDaemonExited {
+		return nil, fmt.Errorf("daemon failed to start: %s", strings.TrimSpace(stderr.String()))
+	}
+	return client, err
+}
+
+// errDaemonExited signals that a spawned daemon died before it started listening.
+var errDaemonExited = errors.New("daemon exited")
+
+// waitForDaemon retries dial every interval until it succeeds, the daemon
+// exits (errDaemonExited), or timeout passes.
+func waitForDaemon(dial func() (*rpc.Client, error), exited <-chan struct{}, interval, timeout time.Duration) (*rpc.Client, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(interval)
+		client, err := dial()
 		if err == nil {
 			return client, nil
 		}
+
+		// The daemon died before listening; report its error instead of waiting
+		select {
+		case <-exited:
+			return nil, errDaemonExited
+		default:
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for daemon to start after %s (it is still running but not listening; raise CNOTE_SPAWN_TIMEOUT on a busy machine)", timeout)
+		}
+	}
+}
+
+// cwdSessionName derives a session name from a directory, so each project
+// directory gets its own daemon. The name is a SHA-256 prefix of the cleaned
+// path: stable across runs, and 64 bits make collisions negligible.
+func cwdSessionName(dir string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(dir)))
+	return "cnote-" + hex.EncodeToString(sum[:8])
+}
+
+// sessionSocketPath returns the socket for the named session, in the same
+// directory as base (or, for an abstract base, the abstract namespace).
+func sessionSocketPath(base, name string) string {
+	if isAbstractSocket(base) {
+		return "@" + name
+	}
+	return filepath.Join(filepath.Dir(base), name+".sock")
+}
+
+// cwdSocketPath returns the socket of the session for the current directory,
+// placed beside the configured socket so CNOTE_SOCKET still picks the directory.
+func cwdSocketPath() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine the current directory: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved // The same directory reached through a symlink is the same session
+	}
+	return sessionSocketPath(SocketPath, cwdSessionName(dir)), nil
+}
+
+// useSocket points this process at path. It also sets CNOTE_SOCKET, which a
+// daemon spawned from here inherits, so both ends agree on the socket. The
+// PID file moves beside the new socket too, replacing any CNOTE_PID_FILE, as
+// one shared file would let only a single session run.
+func useSocket(path string) {
+	SocketPath = path
+	os.Setenv("CNOTE_SOCKET", path)
+	os.Setenv("CNOTE_PID_FILE", sidecarPath(".pid"))
+}
+
+// cursorPath returns the file holding the "list --since-last" cursor.
+// It lives beside the socket so each socket keeps its own cursor.
+func cursorPath() string {
+	return sidecarPath(".cursor")
+}
+
+// exportCursorPath returns the file holding the "export --incremental" cursor,
+// kept apart from the list cursor so the two never skip each other's notes.
+func exportCursorPath() string {
+	return sidecarPath(".export-cursor")
+}
+
+// readCursor loads the last-seen note ID. A missing file means nothing has been seen yet.
+func readCursor(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cursor: %v", err)
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("corrupt cursor file %s", path)
+	}
+	return id, nil
+}
+
+// writeCursor saves the last-seen note ID.
+func writeCursor(path string, id int) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(id)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to save cursor: %v", err)
+	}
+	return nil
+}
+
+// maxNoteID returns the highest ID among notes, or floor if none is higher.
+func maxNoteID(notes []Note, floor int) int {
+	highest := floor
+	for _, n := range notes {
+		if n.ID > highest {
+			highest = n.ID
+		}
+	}
+	return highest
+}
+
+// daemonAlive reports whether a daemon currently accepts connections on SocketPath.
+func daemonAlive() bool {
+	client, err := rpc.Dial("unix", SocketPath)
+	if err != nil {
+		return false
+	}
+	client.Close()
+	return true
+}
+
+// waitForShutdown polls alive every interval until it reports false.
+// A positive timeout bounds the wait; zero waits indefinitely.
+func waitForShutdown(alive func() bool, interval, timeout time.Duration) error {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	for alive() {
+		select {
+		case <-deadline:
+			return fmt.Errorf("session still active after %s", timeout)
+		case <-time.After(interval):
+		}
+	}
+	return nil
+}
+
+// purgeCandidates lists the cnote sockets and PID files found in dirs, plus
+// any extra paths that exist, each once.
+func purgeCandidates(dirs []string, extra ...string) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(path string) {
+		if _, err := os.Lstat(path); err == nil && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, dir := range dirs {
+		for _, pattern := range []string{"cnote*.sock", "cnote*.pid"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+			for _, m := range matches {
+				add(m)
+			}
+		}
+	}
+	for _, path := range extra {
+		add(path)
+	}
+	return paths
+}
+
+// purge stops every daemon behind paths (sockets and PID files), then
+// deletes the files, reporting each action to w. A daemon gets SIGTERM and,
+// if still running after grace, SIGKILL. A PID file is only trusted if the
+// process looks like a cnote daemon, so a recycled PID is never signalled.
+// It returns the number of actions taken.
+func purge(paths []string, grace time.Duration, w io.Writer) int {
+	var pids []int
+	seen := map[int]bool{os.Getpid(): true} // Never stop ourselves
+	for _, path := range paths {
+		if pid, ok := daemonPID(path); ok && !seen[pid] {
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+
+	actions := 0
+	for _, pid := range pids {
+		if stopProcess(pid, grace) {
+			fmt.Fprintf(w, "Killed daemon %d (it ignored SIGTERM)\n", pid)
+		} else {
+			fmt.Fprintf(w, "Stopped daemon %d\n", pid)
+		}
+		actions++
+	}
+	// Daemons remove their own files on SIGTERM; whatever is left is stale
+	for _, path := range paths {
+		if err := os.Remove(path); err == nil {
+			fmt.Fprintf(w, "Removed %s\n", path)
+			actions++
+		}
+	}
+	return actions
+}
+
+// daemonPID returns the process behind a socket (by asking it) or PID file.
+func daemonPID(path string) (int, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, false
+	}
+	if info.Mode()&os.ModeSocket != 0 {
+		client, err := rpc.Dial("unix", path)
+		if err != nil {
+			return 0, false // Nobody listening: a stale socket
+		}
+		defer client.Close()
+		var reply HealthReply
+		if err := callRPC(client, "NoteService.Health", EmptyArgs{}, &reply); err != nil {
+			return 0, false
+		}
+		return reply.PID, true
+	}
+	pid, err := readPIDFile(path)
+	if err != nil || !processAlive(pid) || !isDaemonProcess(pid) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// isDaemonProcess reports whether pid was started as "<binary> daemon", the
+// way getClient spawns it. Without /proc this cannot be checked, so it is false.
+func isDaemonProcess(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	return len(args) >= 2 && args[len(args)-1] == "daemon"
+}
+
+// stopProcess sends SIGTERM to pid and waits up to grace for it to exit,
+// then sends SIGKILL. It reports whether SIGKILL was needed.
+func stopProcess(pid int, grace time.Duration) bool {
+	syscall.Kill(pid, syscall.SIGTERM)
+	alive := func() bool { return processAlive(pid) }
+	if waitForShutdown(alive, 20*time.Millisecond, grace) == nil {
+		return false
 	}
-	return nil, fmt.Errorf("timeout waiting for daemon to start")
+	syscall.Kill(pid, syscall.SIGKILL)
+	waitForShutdown(alive, 20*time.Millisecond, grace)
+	return true
 }
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClient stands in for *rpc.Client, answering calls through handle.
+// A non-zero delay makes every call take that long to complete.
+type fakeClient struct {
+	delay  time.Duration
+	handle func(method string, args any, reply any) error
+}
+
+// Go mimics rpc.Client.Go by completing the call asynchronously.
+func (f *fakeClient) Go(method string, args any, reply any, done chan *rpc.Call) *rpc.Call {
+	call := &rpc.Call{ServiceMethod: method, Args: args, Reply: reply, Done: done}
+	go func() {
+		time.Sleep(f.delay)
+		if f.handle != nil {
+			call.Error = f.handle(method, args, reply)
+		}
+		done <- call
+	}()
+	return call
+}
+
+// TestCallRPCTimeout verifies a slow daemon produces an error instead of blocking.
+func TestCallRPCTimeout(t *testing.T) {
+	t.Setenv("CNOTE_RPC_TIMEOUT", "50ms")
+
+	// 1. Slow call exceeds the timeout
+	slow := &fakeClient{delay: time.Second}
+	start := time.Now()
+	err := callRPC(slow, "NoteService.List", ListFilter{}, &ListReply{})
+	if err == nil {
+		t.Fatal("Expected a timeout error but got none")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("callRPC did not give up promptly")
+	}
+
+	// 2. Fast call returns its result
+	fast := &fakeClient{handle: func(method string, args any, reply any) error {
+		reply.(*NoteReply).Message = "ok"
+		return nil
+	}}
+	var reply NoteReply
+	if err := callRPC(fast, "NoteService.Add", AddArgs{}, &reply); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reply.Message != "ok" {
+		t.Errorf("Expected reply message 'ok', got %q", reply.Message)
+	}
+}
+
+// TestRPCTimeoutConfig verifies CNOTE_RPC_TIMEOUT parsing and its fallback.
+func TestRPCTimeoutConfig(t *testing.T) {
+	t.Setenv("CNOTE_RPC_TIMEOUT", "")
+	if got := rpcTimeout(); got != defaultRPCTimeout {
+		t.Errorf("Expected default %v, got %v", defaultRPCTimeout, got)
+	}
+	t.Setenv("CNOTE_RPC_TIMEOUT", "10s")
+	if got := rpcTimeout(); got != 10*time.Second {
+		t.Errorf("Expected 10s, got %v", got)
+	}
+	t.Setenv("CNOTE_RPC_TIMEOUT", "soon")
+	if got := rpcTimeout(); got != defaultRPCTimeout {
+		t.Errorf("Expected default for invalid value, got %v", got)
+	}
+}
+
+// TestCursorReadWrite verifies the since-last cursor round-trips through its file.
+func TestCursorReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cnote.cursor")
+
+	// 1. First run: no file means cursor 0
+	id, err := readCursor(path)
+	if err != nil || id != 0 {
+		t.Fatalf("Expected cursor 0 for missing file, got %d (err %v)", id, err)
+	}
+
+	// 2. Write and read back
+	if err := writeCursor(path, 7); err != nil {
+		t.Fatalf("writeCursor failed: %v", err)
+	}
+	id, err = readCursor(path)
+	if err != nil || id != 7 {
+		t.Errorf("Expected cursor 7, got %d (err %v)", id, err)
+	}
+
+	// 3. The cursor only moves forward
+	if got := maxNoteID([]Note{{ID: 3}, {ID: 9}}, 7); got != 9 {
+		t.Errorf("Expected cursor to advance to 9, got %d", got)
+	}
+	if got := maxNoteID(nil, 7); got != 7 {
+		t.Errorf("Expected cursor to stay at 7, got %d", got)
+	}
+}
+
+// TestTranslateRPCError verifies unknown-method errors become an upgrade hint and others pass through.
+func TestTranslateRPCError(t *testing.T) {
+	err := translateRPCError(rpc.ServerError("rpc: can't find method NoteService.Search"))
+	if err == nil || !strings.Contains(err.Error(), "daemon is outdated") || !strings.Contains(err.Error(), "NoteService.Search") {
+		t.Errorf("Expected outdated-daemon hint naming the method, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "'cnote clear --stop'") || !strings.Contains(err.Error(), "deletes all notes") {
+		t.Errorf("Expected the hint to restart with clear --stop and warn about data loss, got %v", err)
+	}
+
+	other := rpc.ServerError("note with ID 9 not found")
+	if got := translateRPCError(other); got != other {
+		t.Errorf("Expected other errors unchanged, got %v", got)
+	}
+	if translateRPCError(nil) != nil {
+		t.Error("Expected nil to stay nil")
+	}
+}
+
+// TestWaitForShutdown verifies polling stops once the daemon disappears, or times out.
+func TestWaitForShutdown(t *testing.T) {
+	// 1. Daemon goes away after three polls
+	polls := 0
+	alive := func() bool {
+		polls++
+		return polls <= 3
+	}
+	if err := waitForShutdown(alive, time.Millisecond, time.Second); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if polls != 4 {
+		t.Errorf("Expected 4 polls, got %d", polls)
+	}
+
+	// 2. Daemon never goes away
+	err := waitForShutdown(func() bool { return true }, time.Millisecond, 20*time.Millisecond)
+	if err == nil {
+		t.Error("Expected a timeout error")
+	}
+
+	// 3. No daemon at all returns immediately
+	if err := waitForShutdown(func() bool { return false }, time.Hour, 0); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// TestNoSpawn verifies --no-spawn makes even auto-starting commands fail instead of spawning a daemon.
+func TestNoSpawn(t *testing.T) {
+	originalPath, originalNoSpawn := SocketPath, noSpawn
+	defer func() { SocketPath, noSpawn = originalPath, originalNoSpawn }()
+	SocketPath = filepath.Join(t.TempDir(), "cnote.sock")
+	noSpawn = true
+
+	_, err := getClient(true) // As add would call it
+	if err == nil || !strings.Contains(err.Error(), "--no-spawn") {
+		t.Fatalf("Expected a --no-spawn error, got %v", err)
+	}
+	if daemonAlive() {
+		t.Error("Expected no daemon to be started")
+	}
+}
+
+// TestWaitForDaemon verifies the spawn wait retries until the dialer succeeds,
+// gives up after the timeout, and stops early if the daemon exits.
+func TestWaitForDaemon(t *testing.T) {
+	t.Setenv("CNOTE_SPAWN_TIMEOUT", "5s")
+	if got := spawnTimeout(); got != 5*time.Second {
+		t.Errorf("Expected spawn timeout 5s, got %v", got)
+	}
+	t.Setenv("CNOTE_SPAWN_TIMEOUT", "")
+	if got := spawnTimeout(); got != defaultSpawnTimeout {
+		t.Errorf("Expected default spawn timeout, got %v", got)
+	}
+
+	// dialAfter fails until its nth attempt
+	attempts := 0
+	dialAfter := func(n int) func() (*rpc.Client, error) {
+		attempts = 0
+		return func() (*rpc.Client, error) {
+			attempts++
+			if attempts < n {
+				return nil, errors.New("connection refused")
+			}
+			return &rpc.Client{}, nil
+		}
+	}
+	running := make(chan struct{})
+
+	// 1. Succeeds on the fifth attempt, well within the timeout
+	client, err := waitForDaemon(dialAfter(5), running, time.Millisecond, time.Second)
+	if err != nil || client == nil || attempts != 5 {
+		t.Errorf("Expected success after 5 attempts, got %v after %d", err, attempts)
+	}
+
+	// 2. A daemon that never listens times out with a diagnostic
+	_, err = waitForDaemon(dialAfter(1000000), running, time.Millisecond, 20*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "still running") || !strings.Contains(err.Error(), "CNOTE_SPAWN_TIMEOUT") {
+		t.Errorf("Expected a timeout diagnostic, got %v", err)
+	}
+
+	// 3. A daemon that dies is reported straight away
+	exited := make(chan struct{})
+	close(exited)
+	if _, err := waitForDaemon(dialAfter(1000000), exited, time.Millisecond, time.Second); err != errDaemonExited {
+		t.Errorf("Expected errDaemonExited, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected to stop after 1 attempt, got %d", attempts)
+	}
+}
+
+// TestCwdSessionName verifies directory session names are stable, path-normalized and distinct.
+func TestCwdSessionName(t *testing.T) {
+	a := cwdSessionName("/home/me/project")
+	if a != cwdSessionName("/home/me/project") || a != cwdSessionName("/home/me/project/") || a != cwdSessionName("/home/me/./project") {
+		t.Errorf("Expected one name for equivalent paths, got %q", a)
+	}
+	if !strings.HasPrefix(a, "cnote-") || len(a) != len("cnote-")+16 {
+		t.Errorf("Expected cnote- and 16 hex digits, got %q", a)
+	}
+
+	seen := map[string]string{}
+	for _, dir := range []string{"/home/me/project", "/home/me/project2", "/home/me/Project", "/home/you/project", "/"} {
+		name := cwdSessionName(dir)
+		if other, ok := seen[name]; ok {
+			t.Errorf("%q and %q share session name %q", dir, other, name)
+		}
+		seen[name] = dir
+	}
+}
+
+// TestSessionSocketPath verifies session sockets follow the configured socket
+// directory, and that each session gets its own PID file.
+func TestSessionSocketPath(t *testing.T) {
+	if got := sessionSocketPath("/run/user/1000/cnote.sock", "cnote-ab"); got != "/run/user/1000/cnote-ab.sock" {
+		t.Errorf("Expected the session beside the configured socket, got %q", got)
+	}
+	if got := sessionSocketPath(defaultSocketPath, "cnote-ab"); got != "/tmp/cnote-ab.sock" {
+		t.Errorf("Expected the session in /tmp by default, got %q", got)
+	}
+	if runtime.GOOS == "linux" {
+		if got := sessionSocketPath("@cnote", "cnote-ab"); got != "@cnote-ab" {
+			t.Errorf("Expected an abstract session for an abstract socket, got %q", got)
+		}
+	}
+
+	original := SocketPath
+	defer func() { SocketPath = original }()
+	t.Setenv("CNOTE_SOCKET", "")
+	t.Setenv("CNOTE_PID_FILE", "/var/run/cnote.pid")
+	dir := t.TempDir()
+	useSocket(filepath.Join(dir, "cnote-ab.sock"))
+	first := pidFilePath()
+	useSocket(filepath.Join(dir, "cnote-cd.sock"))
+	if first != filepath.Join(dir, "cnote-ab.pid") || pidFilePath() != filepath.Join(dir, "cnote-cd.pid") {
+		t.Errorf("Expected a PID file per session, got %q and %q", first, pidFilePath())
+	}
+}
+
+// TestPurge verifies discovery of cnote sockets and PID files in a directory,
+// and that purge stops the daemons behind them and removes what is left.
+func TestPurge(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, pid int) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// start runs a shell loop that looks like a spawned daemon ("... daemon")
+	start := func(script string) *exec.Cmd {
+		cmd := exec.Command("sh", "-c", script+"; while :; do sleep 0.05; done", "daemon")
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("cannot start fake daemon: %v", err)
+		}
+		go cmd.Wait() // Reap it so it stops counting as alive
+		t.Cleanup(func() { cmd.Process.Kill() })
+		return cmd
+	}
+
+	// 1. A stale socket nobody listens on
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(dir, "cnote-a.sock"), Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetUnlinkOnClose(false)
+	l.Close()
+
+	// 2. PID files: a dead process, a daemon, a daemon ignoring SIGTERM, and an unrelated process
+	dead := exec.Command("true")
+	dead.Run()
+	write("cnote.pid", dead.Process.Pid)
+	polite := start("true")
+	write("cnote-b.pid", polite.Process.Pid)
+	stubborn := start("trap '' TERM")
+	write("cnote-c.pid", stubborn.Process.Pid)
+	other := exec.Command("sleep", "30")
+	other.Start()
+	go other.Wait()
+	t.Cleanup(func() { other.Process.Kill() })
+	write("cnote-d.pid", other.Process.Pid)
+	write("unrelated.pid", other.Process.Pid)
+
+	paths := purgeCandidates([]string{dir})
+	if len(paths) != 5 {
+		t.Fatalf("Expected 5 candidates, got %v", paths)
+	}
+
+	time.Sleep(50 * time.Millisecond) // Let the TERM trap be installed
+	var out bytes.Buffer
+	if n := purge(paths, 200*time.Millisecond, &out); n != 7 {
+		t.Errorf("Expected 7 actions, got %d:\n%s", n, out.String())
+	}
+	report := out.String()
+	for _, want := range []string{
+		fmt.Sprintf("Stopped daemon %d\n", polite.Process.Pid),
+		fmt.Sprintf("Killed daemon %d (it ignored SIGTERM)\n", stubborn.Process.Pid),
+		"Removed " + filepath.Join(dir, "cnote-a.sock") + "\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected %q in report:\n%s", want, report)
+		}
+	}
+	if processAlive(polite.Process.Pid) || processAlive(stubborn.Process.Pid) {
+		t.Error("Expected both daemons to be gone")
+	}
+	if !processAlive(other.Process.Pid) {
+		t.Error("An unrelated process was signalled")
+	}
+	if left := purgeCandidates([]string{dir}); len(left) != 0 {
+		t.Errorf("Expected no files left, got %v", left)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unrelated.pid")); err != nil {
+		t.Errorf("Expected non-cnote files to be left alone, got %v", err)
+	}
+}
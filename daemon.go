@@ -1,11 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"net/http"
 	"net/rpc"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,40 +23,215 @@ import (
 	"time"
 )
 
-// SocketPath is the location of the Unix domain socket.
+// defaultSocketPath is the location of the Unix domain socket.
 // /tmp is RAM-backed on most Linux distros, making this extremely fast.
-const SocketPath = "/tmp/cnote.sock"
+const defaultSocketPath = "/tmp/cnote.sock"
+
+// SocketPath is the socket actually used by both client and daemon.
+// CNOTE_SOCKET overrides the default, e.g. when /tmp is not writable; on
+// Linux a name starting with "@" uses the abstract namespace instead of a file.
+var SocketPath = socketPath()
+
+// socketPath resolves the socket location from the environment.
+func socketPath() string {
+	if p := os.Getenv("CNOTE_SOCKET"); p != "" {
+		return p
+	}
+	return defaultSocketPath
+}
+
+// isAbstractSocket reports whether path names a Linux abstract socket
+// ("@name"). Those live outside the filesystem and vanish with the daemon,
+// so there is never a stale file to remove.
+func isAbstractSocket(path string) bool {
+	return runtime.GOOS == "linux" && strings.HasPrefix(path, "@")
+}
+
+// removeSocket deletes a socket file left at path, if it is one that leaves files.
+func removeSocket(path string) {
+	if !isAbstractSocket(path) {
+		os.Remove(path)
+	}
+}
+
+// sidecarPath returns the file with extension ext kept next to the socket
+// (e.g. /tmp/cnote.pid). An abstract socket has no directory, so its files
+// go in the temp directory under the socket's name.
+func sidecarPath(ext string) string {
+	base := SocketPath
+	if isAbstractSocket(base) {
+		base = filepath.Join(os.TempDir(), strings.TrimPrefix(base, "@"))
+	}
+	return strings.TrimSuffix(base, ".sock") + ext
+}
+
+// pidFilePath returns where the daemon records its PID: CNOTE_PID_FILE, or
+// next to the socket (/tmp/cnote.pid by default).
+func pidFilePath() string {
+	if p := os.Getenv("CNOTE_PID_FILE"); p != "" {
+		return p
+	}
+	return sidecarPath(".pid")
+}
+
+// logFilePath returns where a running daemon writes its log: CNOTE_LOG_FILE,
+// or next to the socket (/tmp/cnote.log by default).
+func logFilePath() string {
+	if p := os.Getenv("CNOTE_LOG_FILE"); p != "" {
+		return p
+	}
+	return sidecarPath(".log")
+}
+
+// readPIDFile returns the PID recorded at path.
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("corrupt PID file %s", path)
+	}
+	return pid, nil
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// isLiveDaemon reports whether pid is a running cnote daemon, and not an
+// unrelated process that reused the PID of one that crashed: its command line
+// says so, or the daemon answering on socket reports that PID.
+func isLiveDaemon(pid int, socket string) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	if isDaemonProcess(pid) {
+		return true
+	}
+	// No /proc (or an unusual command line): ask the daemon itself
+	client, err := rpc.Dial("unix", socket)
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	var reply HealthReply
+	return callRPC(client, "NoteService.Health", EmptyArgs{}, &reply) == nil && reply.PID == pid
+}
+
+// claimPIDFile writes the PID file unless another live daemon owns it.
+// The file is only a convenience for external tools, so failing to write it is logged, not fatal.
+func (s *NoteService) claimPIDFile(path string) error {
+	if pid, err := readPIDFile(path); err == nil && pid != os.Getpid() && isLiveDaemon(pid, SocketPath) {
+		return fmt.Errorf("another daemon is running (pid %d, see %s)", pid, path)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		log.Printf("cannot write PID file: %v", err)
+		return nil
+	}
+	s.pidFile = path
+	return nil
+}
 
 // NoteService acts as the RPC server holding the in-memory state.
+//
+// Invariants: every exported method holds mu for its whole body, and nothing
+// in a reply points into notes (see snapshot), because net/rpc encodes the
+// reply after the method has returned.
 type NoteService struct {
 	mu     sync.Mutex // Mutex ensures thread-safety during concurrent access
 	notes  []*Note    // The slice where notes live
 	nextID int        // Auto-increment counter
+	title  string     // Optional session description
+	exit   func()     // Replaces process termination when set (used by tests)
+
+	keys    map[string]int // Idempotency keys of live notes, mapped to their IDs
+	started time.Time      // When the daemon started, reported by Health
+
+	webhook  string       // URL that receives new notes as JSON (CNOTE_WEBHOOK)
+	readOnly bool         // Reject mutating RPCs (CNOTE_READONLY=1)
+	limiter  *rateLimiter // Caps adds per second (CNOTE_RATE_LIMIT); nil means unlimited
+	pidFile  string       // PID file removed on shutdown, if one was written
+
+	keepPinned bool // Auto-shutdown never fires while a pinned note exists (CNOTE_SHUTDOWN_IGNORES_PINS=1)
 }
 
-// StartDaemon initializes the background process.
-// This is only called when the user runs 'cnote add' and no daemon exists.
-func StartDaemon() {
-	// 1. Clean up potential stale socket files from previous crashes
-	os.Remove(SocketPath)
+// webhookTimeout bounds each webhook delivery so a slow endpoint cannot pile up requests.
+const webhookTimeout = 5 * time.Second
 
-	// 2. Initialize state
-	service := &NoteService{
+// newNoteService returns an empty service ready to accept notes.
+func newNoteService() *NoteService {
+	return &NoteService{
 		notes:  make([]*Note, 0),
 		nextID: 1,
+		keys:   make(map[string]int),
 	}
+}
 
-	// 3. Register RPC Service
+// listenDaemon registers the service on a new RPC server and opens the socket at path.
+// Serving is left to the caller so tests can run a real daemon in a goroutine.
+func listenDaemon(service *NoteService, path string) (*rpc.Server, net.Listener, error) {
 	rpcServer := rpc.NewServer()
-	rpcServer.RegisterName("NoteService", service)
+	if err := rpcServer.RegisterName("NoteService", service); err != nil {
+		return nil, nil, err
+	}
+
+	// Unix Socket is faster/safer than TCP for local CLI
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot listen on %s: %v (set CNOTE_SOCKET to a writable path)", path, err)
+	}
+	return rpcServer, l, nil
+}
 
-	// 4. Listen on Unix Socket (faster/safer than TCP for local CLI)
-	l, err := net.Listen("unix", SocketPath)
+// StartDaemon initializes the background process and serves until shutdown.
+// This is only called when the user runs 'cnote add' and no daemon exists.
+// It returns an error if the socket cannot be created.
+func StartDaemon() error {
+	// 1. Initialize state
+	service := newNoteService()
+	service.started = time.Now()
+	service.webhook = os.Getenv("CNOTE_WEBHOOK")
+	service.readOnly = os.Getenv("CNOTE_READONLY") == "1"
+	service.keepPinned = os.Getenv("CNOTE_SHUTDOWN_IGNORES_PINS") == "1"
+	if v := os.Getenv("CNOTE_RATE_LIMIT"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("invalid CNOTE_RATE_LIMIT %q: want a positive number of adds per second", v)
+		}
+		service.limiter = newRateLimiter(rate, time.Now)
+	}
+
+	// 2. Claim the PID file, then clean up potential stale socket files from previous crashes
+	if err := service.claimPIDFile(pidFilePath()); err != nil {
+		return err
+	}
+	removeSocket(SocketPath)
+
+	// 3. Register RPC Service and listen on the socket
+	rpcServer, l, err := listenDaemon(service, SocketPath)
 	if err != nil {
-		panic(err)
+		if service.pidFile != "" {
+			os.Remove(service.pidFile)
+		}
+		return err
+	}
+
+	// Startup errors went to stderr for the spawning client to report, but that
+	// pipe dies with the client, so from here on the daemon logs to a file
+	if f, err := os.OpenFile(logFilePath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600); err != nil {
+		log.Printf("cannot open log file: %v", err)
+	} else {
+		log.SetOutput(f)
 	}
 
-	// 5. Handle OS Interrupts (Ctrl+C) gracefully
+	// 4. Handle OS Interrupts (Ctrl+C) gracefully.
+	// SIGPIPE is ignored so a write to the client's closed stderr pipe cannot
+	// kill the daemon.
+	signal.Ignore(syscall.SIGPIPE)
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
@@ -54,29 +239,132 @@ func StartDaemon() {
 		service.shutdown()
 	}()
 
-	// 6. Begin serving requests
+	// SIGUSR1 logs a snapshot of the notes for debugging a live daemon
+	dump := make(chan os.Signal, 1)
+	signal.Notify(dump, syscall.SIGUSR1)
+	go func() {
+		for range dump {
+			service.logState()
+		}
+	}()
+
+	// 5. Begin serving requests
 	rpcServer.Accept(l)
+	return nil
+}
+
+// logState writes the current state to the daemon log.
+func (s *NoteService) logState() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	dumpState(&b, s.title, s.nextID, s.notes)
+	log.Print(b.String())
+}
+
+// dumpState writes a human-readable snapshot of the daemon's notes to w.
+func dumpState(w io.Writer, title string, nextID int, notes []*Note) {
+	fmt.Fprintf(w, "state: %d notes, next ID %d", len(notes), nextID)
+	if title != "" {
+		fmt.Fprintf(w, ", title %q", title)
+	}
+	fmt.Fprintln(w)
+	for _, n := range notes {
+		pin := ""
+		if n.Pinned {
+			pin = " [pinned]"
+		}
+		fmt.Fprintf(w, "  #%d%s %s %q\n", n.ID, pin, n.CreatedAt.Format(time.RFC3339), visibleText(n))
+	}
+}
+
+// rateLimiter is a token bucket: it holds up to burst tokens, refilled at
+// rate per second, and each allowed event spends one.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time // Injectable clock for tests
+}
+
+// newRateLimiter returns a full bucket allowing rate events per second,
+// with bursts of up to one second's worth (at least one event).
+func newRateLimiter(rate float64, now func() time.Time) *rateLimiter {
+	burst := max(rate, 1)
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: now(), now: now}
+}
+
+// allow spends a token if one is available.
+func (l *rateLimiter) allow() bool {
+	return l.allowN(1)
+}
+
+// allowN spends n tokens if that many are available, and none otherwise.
+func (l *rateLimiter) allowN(n int) bool {
+	t := l.now()
+	l.tokens = min(l.burst, l.tokens+t.Sub(l.last).Seconds()*l.rate)
+	l.last = t
+	if l.tokens < float64(n) {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
 }
 
 // shutdown cleans up resources and exits the process.
 func (s *NoteService) shutdown() {
-	os.Remove(SocketPath)
+	if s.pidFile != "" {
+		os.Remove(s.pidFile)
+	}
+	if s.exit != nil {
+		s.exit()
+		return
+	}
+	removeSocket(SocketPath)
 	os.Exit(0)
 }
 
+// empty reports whether the session counts as empty for auto-shutdown: it
+// holds no notes. With keepPinned, a pinned note also vetoes the shutdown on
+// its own, so pins keep the daemon alive whatever else is removed. The caller
+// must hold s.mu.
+func (s *NoteService) empty() bool {
+	if s.keepPinned && slices.ContainsFunc(s.notes, func(n *Note) bool { return n.Pinned }) {
+		return false
+	}
+	return len(s.notes) == 0
+}
+
 // checkAutoShutdown looks at the note count.
-// If zero, it triggers a self-destruct sequence to free system memory.
+// If the session is empty, it triggers a self-destruct sequence to free system memory.
+// The caller must hold s.mu.
 func (s *NoteService) checkAutoShutdown() {
-	if len(s.notes) == 0 {
+	if s.empty() {
 		// Run in a goroutine to allow the current RPC call to return successfully
 		// to the client before the server dies.
 		go func() {
 			time.Sleep(100 * time.Millisecond)
-			s.shutdown()
+
+			// Another client may have added a note during the delay;
+			// only exit if the session is still empty.
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.empty() {
+				s.shutdown()
+			}
 		}()
 	}
 }
 
+// checkWritable guards mutating RPCs when the daemon runs in read-only mode.
+func (s *NoteService) checkWritable() error {
+	if s.readOnly {
+		return fmt.Errorf("session is read-only")
+	}
+	return nil
+}
+
 // resolveID converts "first", "last", or "123" into a specific Note and index.
 func (s *NoteService) resolveID(idStr string) (*Note, int, error) {
 	if len(s.notes) == 0 {
@@ -108,21 +396,166 @@ func (s *NoteService) resolveID(idStr string) (*Note, int, error) {
 
 // --- RPC Methods ---
 
+// defaultSource is recorded for notes whose origin is not specified.
+const defaultSource = "cli"
+
+// placeholderText is the text of notes created by Touch, meant to be filled in later with Edit.
+const placeholderText = "(empty)"
+
+// validateText rejects note text that is empty or only whitespace.
+func validateText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("note text cannot be empty")
+	}
+	return nil
+}
+
+// formatJSON marks notes whose text must stay valid JSON.
+const formatJSON = "json"
+
+// validateFormat checks text against the note's body format.
+func validateFormat(text, format string) error {
+	switch format {
+	case "":
+		return nil
+	case formatJSON:
+		if !json.Valid([]byte(text)) {
+			return fmt.Errorf("note text is not valid JSON")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown note format %q", format)
+	}
+}
+
+// checkFreeID rejects an explicit ID that is invalid or already in use.
+// The caller must hold s.mu.
+func (s *NoteService) checkFreeID(id int) error {
+	if id < 0 {
+		return fmt.Errorf("ID must be positive")
+	}
+	for _, n := range s.notes {
+		if n.ID == id {
+			return fmt.Errorf("ID %d is already taken", id)
+		}
+	}
+	return nil
+}
+
+// addLocked creates a note from args, honoring an explicit ID (already validated).
+// The caller must hold s.mu.
+func (s *NoteService) addLocked(args AddArgs) *Note {
+	id := s.nextID
+	if args.ID > 0 {
+		id = args.ID
+	}
+	source := args.Source
+	if source == "" {
+		source = defaultSource
+	}
+	now := time.Now()
+	n := &Note{
+		ID:           id,
+		Text:         args.Text,
+		Pinned:       args.Pinned || args.Top,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Source:       source,
+		Format:       args.Format,
+		ExpireOnRead: args.ExpireOnRead,
+	}
+	if n.Pinned {
+		n.PinnedAt = &now
+	}
+	if args.LinkLast && len(s.notes) > 0 {
+		// Chain onto the previous note; an empty list has nothing to link to
+		prev, _, _ := s.resolveID("last")
+		n.Links = []int{prev.ID}
+		prev.Links = addLink(prev.Links, n.ID)
+		prev.UpdatedAt = now
+	}
+	if args.Top {
+		s.notes = append([]*Note{n}, s.notes...)
+	} else {
+		s.notes = append(s.notes, n)
+	}
+	// Keep auto-assigned IDs ahead of any explicit one
+	if id >= s.nextID {
+		s.nextID = id + 1
+	}
+	if args.IdempotencyKey != "" {
+		s.keys[args.IdempotencyKey] = n.ID
+	}
+	if !n.ExpireOnRead {
+		s.postWebhook(*n) // Never send a one-time secret anywhere
+	}
+	return n
+}
+
+// postWebhook sends a copy of a new note to the configured webhook, if any.
+// Delivery happens in the background; failures are logged and never reach the client.
+func (s *NoteService) postWebhook(n Note) {
+	if s.webhook == "" {
+		return
+	}
+	go func() {
+		body, err := json.Marshal(n)
+		if err != nil {
+			log.Printf("webhook: %v", err)
+			return
+		}
+		client := &http.Client{Timeout: webhookTimeout}
+		resp, err := client.Post(s.webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("webhook: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("webhook: unexpected status %s", resp.Status)
+		}
+	}()
+}
+
 // Add creates a new note.
 func (s *NoteService) Add(args AddArgs, reply *NoteReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	n := &Note{
-		ID:        s.nextID,
-		Text:      args.Text,
-		Pinned:    args.Pinned,
-		CreatedAt: time.Now(),
+	if err := s.checkWritable(); err != nil {
+		return err
 	}
-	s.notes = append(s.notes, n)
-	s.nextID++
 
-	reply.Note = n
+	if err := validateText(args.Text); err != nil {
+		return err
+	}
+	if err := validateFormat(args.Text, args.Format); err != nil {
+		return err
+	}
+	// A retried add with a known key returns the note it created
+	if existing := s.findByKey(args.IdempotencyKey); existing != nil {
+		reply.Note = snapshot(existing)
+		reply.Message = fmt.Sprintf("Note already added (ID: %d)", existing.ID)
+		return nil
+	}
+	if err := s.checkFreeID(args.ID); err != nil {
+		return err
+	}
+
+	// Debounce: a recent identical note absorbs this add
+	if dup := s.recentDuplicate(args.Text, args.DedupeWindow, time.Now()); dup != nil {
+		reply.Note = snapshot(dup)
+		reply.Message = fmt.Sprintf("Duplicate suppressed (ID: %d)", dup.ID)
+		return nil
+	}
+	// Only adds that create a note spend the rate budget
+	if s.limiter != nil && !s.limiter.allow() {
+		return fmt.Errorf("rate limited: too many adds, try again shortly")
+	}
+
+	n := s.addLocked(args)
+
+	reply.Note = snapshot(n)
 	status := ""
 	if n.Pinned {
 		status = " (Pinned)"
@@ -131,17 +564,372 @@ func (s *NoteService) Add(args AddArgs, reply *NoteReply) error {
 	return nil
 }
 
-// List returns all notes.
-func (s *NoteService) List(args EmptyArgs, reply *ListReply) error {
+// findByKey returns the live note created with an idempotency key, if any.
+// The caller must hold s.mu.
+func (s *NoteService) findByKey(key string) *Note {
+	if key == "" {
+		return nil
+	}
+	id, ok := s.keys[key]
+	if !ok {
+		return nil
+	}
+	for _, n := range s.notes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// recentDuplicate returns a note with identical text created within window of now, if any.
+// A zero window disables the check. The caller must hold s.mu.
+func (s *NoteService) recentDuplicate(text string, window time.Duration, now time.Time) *Note {
+	if window <= 0 {
+		return nil
+	}
+	for i := len(s.notes) - 1; i >= 0; i-- {
+		n := s.notes[i]
+		if n.Text == text && now.Sub(n.CreatedAt) <= window {
+			return n
+		}
+	}
+	return nil
+}
+
+// AddMany creates several notes at once, in order.
+func (s *NoteService) AddMany(args AddManyArgs, reply *CountReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	// Validate the whole batch first so it is added all-or-nothing
+	requested := make(map[int]bool)
+	for _, item := range args.Items {
+		if err := validateText(item.Text); err != nil {
+			return err
+		}
+		if err := validateFormat(item.Text, item.Format); err != nil {
+			return err
+		}
+		if err := s.checkFreeID(item.ID); err != nil {
+			return err
+		}
+		if item.ID > 0 && requested[item.ID] {
+			return fmt.Errorf("ID %d is requested twice", item.ID)
+		}
+		requested[item.ID] = true
+	}
+	// Each item costs a token, so a script cannot dodge CNOTE_RATE_LIMIT by batching
+	if s.limiter != nil && !s.limiter.allowN(len(args.Items)) {
+		if float64(len(args.Items)) > s.limiter.burst {
+			return fmt.Errorf("rate limited: a batch of %d notes exceeds the limit of %g adds at once", len(args.Items), s.limiter.burst)
+		}
+		return fmt.Errorf("rate limited: too many adds, try again shortly")
+	}
+	for _, item := range args.Items {
+		s.addLocked(item)
+	}
+	reply.Count = len(args.Items)
+	reply.Message = fmt.Sprintf("Added %d notes", reply.Count)
+	return nil
+}
+
+// Restore replaces every note with args.Notes in one step, keeping their IDs
+// and timestamps. nextID moves past the highest restored ID.
+func (s *NoteService) Restore(args RestoreArgs, reply *CountReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	// Validate everything before touching the current notes
+	seen := make(map[int]bool)
+	for _, n := range args.Notes {
+		if n.ID <= 0 {
+			return fmt.Errorf("note ID %d must be positive", n.ID)
+		}
+		if seen[n.ID] {
+			return fmt.Errorf("ID %d appears twice", n.ID)
+		}
+		seen[n.ID] = true
+		if err := validateText(n.Text); err != nil {
+			return fmt.Errorf("note %d: %v", n.ID, err)
+		}
+		if err := validateFormat(n.Text, n.Format); err != nil {
+			return fmt.Errorf("note %d: %v", n.ID, err)
+		}
+	}
+
+	notes := make([]*Note, len(args.Notes))
+	maxID := 0
+	for i := range args.Notes {
+		n := args.Notes[i]
+		maxID = max(maxID, n.ID)
+		notes[i] = &n
+	}
+	s.notes = notes
+	s.nextID = maxID + 1
+	s.keys = make(map[string]int)
+	// Keep only links Link could have made: to other restored notes, once each
+	byID := make(map[int]*Note, len(s.notes))
+	for _, n := range s.notes {
+		byID[n.ID] = n
+		var links []int
+		for _, id := range n.Links {
+			if seen[id] && id != n.ID {
+				links = addLink(links, id)
+			}
+		}
+		n.Links = links
+	}
+	// Links are symmetric, so a one-sided one is completed (keeping each note's own order)
+	for _, n := range s.notes {
+		for _, id := range n.Links {
+			byID[id].Links = addLink(byID[id].Links, n.ID)
+		}
+	}
+
+	reply.Count = len(s.notes)
+	reply.Message = fmt.Sprintf("Restored %d notes", reply.Count)
+	s.checkAutoShutdown()
+	return nil
+}
+
+// Touch creates a placeholder note, the one exception to the empty-text rule.
+func (s *NoteService) Touch(args EmptyArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	n := s.addLocked(AddArgs{Text: placeholderText})
+	reply.Note = snapshot(n)
+	reply.Message = fmt.Sprintf("Placeholder note added (ID: %d)", n.ID)
+	return nil
+}
+
+// Edit replaces the text of an existing note.
+func (s *NoteService) Edit(args EditArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := validateText(args.Text); err != nil {
+		return err
+	}
+	if args.Append && args.Prepend {
+		return fmt.Errorf("append and prepend cannot be combined")
+	}
+	note, _, err := s.resolveID(args.IDStr)
+	if err != nil {
+		return err
+	}
+	// Optimistic locking: refuse to overwrite a change the editor has not seen
+	if !args.ExpectedUpdatedAt.IsZero() && !note.UpdatedAt.Equal(args.ExpectedUpdatedAt) {
+		return fmt.Errorf("note %d was changed at %s; re-read it and retry", note.ID, note.UpdatedAt.Format(time.RFC3339Nano))
+	}
+	text := args.Text
+	switch {
+	case args.Append:
+		text = joinText(note.Text, args.Text)
+	case args.Prepend:
+		text = joinText(args.Text, note.Text)
+	}
+	// A JSON note stays JSON
+	if err := validateFormat(text, note.Format); err != nil {
+		return err
+	}
+	note.Text = text
+	note.UpdatedAt = time.Now()
+	reply.Note = snapshot(note)
+	reply.Message = fmt.Sprintf("Edited note %d", note.ID)
+	return nil
+}
+
+// joinText concatenates two pieces of note text, adding a space between
+// them unless one side already has whitespace at the join.
+func joinText(a, b string) string {
+	if strings.HasSuffix(a, " ") || strings.HasSuffix(a, "\n") || strings.HasPrefix(b, " ") || strings.HasPrefix(b, "\n") {
+		return a + b
+	}
+	return a + " " + b
+}
+
+// hiddenText stands in for the text of expire-on-read notes outside of Show.
+const hiddenText = "[hidden]"
+
+// visibleText returns the text a note may reveal to list, search and match operations.
+func visibleText(n *Note) string {
+	if n.ExpireOnRead {
+		return hiddenText
+	}
+	return n.Text
+}
+
+// snapshot returns a copy of the note for a reply. net/rpc encodes replies
+// after the method returns and s.mu is released, so a reply must never alias
+// a live note (or its Links) that a concurrent call could change.
+func snapshot(n *Note) *Note {
+	c := *n
+	c.Links = slices.Clone(n.Links)
+	return &c
+}
+
+// listed returns a copy of the note safe to hand out in bulk, with its text masked if needed.
+func listed(n *Note) Note {
+	c := *snapshot(n)
+	c.Text = visibleText(n)
+	return c
+}
+
+// matches reports whether a note satisfies every field set in the filter.
+func (f ListFilter) matches(n *Note) bool {
+	if f.Pinned != nil && n.Pinned != *f.Pinned {
+		return false
+	}
+	if f.Text != "" && !strings.Contains(strings.ToLower(visibleText(n)), strings.ToLower(f.Text)) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !n.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !n.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// List returns all notes matching the filter, in insertion order.
+func (s *NoteService) List(args ListFilter, reply *ListReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Return a copy to ensure thread safety
-	list := make([]Note, len(s.notes))
-	for i, n := range s.notes {
-		list[i] = *n
+	list := make([]Note, 0, len(s.notes))
+	for _, n := range s.notes {
+		if args.matches(n) {
+			list = append(list, listed(n))
+		}
+	}
+	reply.Notes = list
+	reply.Title = s.title
+	return nil
+}
+
+// Since returns notes whose ID is greater than args.ID.
+// A cursor beyond any ID this daemon has issued must come from an earlier
+// session, so it is treated as zero and every note is returned.
+func (s *NoteService) Since(args SinceArgs, reply *ListReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor := args.ID
+	if cursor >= s.nextID {
+		cursor = 0
+	}
+
+	list := make([]Note, 0, len(s.notes))
+	for _, n := range s.notes {
+		if n.ID > cursor {
+			list = append(list, listed(n))
+		}
 	}
 	reply.Notes = list
+	reply.Title = s.title
+	return nil
+}
+
+// fuzzyScore rates how well query matches text as an in-order subsequence
+// (case-insensitive). It returns false if some query character is missing.
+// Adjacent matches and matches at the start of a word score higher; gaps cost a little.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	// Try every occurrence of the first character as the anchor and keep the best
+	best, found := 0, false
+	for start := range t {
+		if t[start] != q[0] {
+			continue
+		}
+		if score, ok := fuzzyScoreFrom(q, t, start); ok && (!found || score > best) {
+			best, found = score, true
+		}
+	}
+	return best, found
+}
+
+// fuzzyScoreFrom greedily matches q against t, starting with q[0] at t[start].
+// Matches further into the text start with a small (capped) penalty.
+func fuzzyScoreFrom(q, t []rune, start int) (int, bool) {
+	score, qi, last := -min(start, 10), 0, -1
+	for ti := start; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score += 10
+		if last >= 0 && ti == last+1 {
+			score += 15 // Consecutive characters
+		} else if last >= 0 {
+			score -= ti - last - 1 // Gap since the previous match
+		}
+		if ti == 0 || t[ti-1] == ' ' {
+			score += 10 // Beginning of a word
+		}
+		last = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// Search returns notes whose text matches the query. Plain searches are
+// case-insensitive substring matches in list order; fuzzy searches are
+// ordered by descending score.
+func (s *NoteService) Search(args SearchArgs, reply *ListReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if args.Query == "" {
+		return fmt.Errorf("search query cannot be empty")
+	}
+
+	list := make([]Note, 0)
+	if !args.Fuzzy {
+		filter := ListFilter{Text: args.Query}
+		for _, n := range s.notes {
+			if filter.matches(n) {
+				list = append(list, listed(n))
+			}
+		}
+		reply.Notes = list
+		return nil
+	}
+
+	scores := make(map[int]int)
+	for _, n := range s.notes {
+		if score, ok := fuzzyScore(args.Query, visibleText(n)); ok {
+			scores[n.ID] = score
+			list = append(list, listed(n))
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return scores[list[i].ID] > scores[list[j].ID]
+	})
+	reply.Notes = list
 	return nil
 }
 
@@ -150,6 +938,10 @@ func (s *NoteService) Remove(args IDArgs, reply *NoteReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	note, idx, err := s.resolveID(args.IDStr)
 	if err != nil {
 		return err
@@ -157,6 +949,8 @@ func (s *NoteService) Remove(args IDArgs, reply *NoteReply) error {
 
 	// Delete from slice
 	s.notes = append(s.notes[:idx], s.notes[idx+1:]...)
+	s.forget(note.ID)
+	reply.Note = snapshot(note)
 	reply.Message = fmt.Sprintf("Removed note %d", note.ID)
 
 	// Crucial: Check if we should kill the process
@@ -164,28 +958,194 @@ func (s *NoteService) Remove(args IDArgs, reply *NoteReply) error {
 	return nil
 }
 
-// Clear deletes everything and shuts down.
-func (s *NoteService) Clear(args EmptyArgs, reply *NoteReply) error {
+// removeWhere deletes every note for which match returns true and returns copies of them.
+// The caller must hold s.mu.
+func (s *NoteService) removeWhere(match func(*Note) bool) []Note {
+	var removed []Note
+	kept := s.notes[:0]
+	for _, n := range s.notes {
+		if match(n) {
+			removed = append(removed, *n)
+		} else {
+			kept = append(kept, n)
+		}
+	}
+	s.notes = kept
+	for _, n := range removed {
+		s.forget(n.ID)
+	}
+	return removed
+}
+
+// forget drops everything that still refers to a removed note:
+// links from other notes and its idempotency key.
+func (s *NoteService) forget(id int) {
+	s.pruneLinks(id)
+	for key, keyID := range s.keys {
+		if keyID == id {
+			delete(s.keys, key)
+		}
+	}
+}
+
+// pruneLinks drops references to a removed note so no link dangles.
+func (s *NoteService) pruneLinks(id int) {
+	for _, n := range s.notes {
+		n.Links = removeLink(n.Links, id)
+	}
+}
+
+// textMatcher builds the predicate used by MatchArgs.
+func textMatcher(args MatchArgs) (func(*Note) bool, error) {
+	if args.Pattern == "" {
+		return nil, fmt.Errorf("pattern cannot be empty")
+	}
+	if args.Regex {
+		re, err := regexp.Compile(args.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		return func(n *Note) bool { return re.MatchString(visibleText(n)) }, nil
+	}
+	pattern := strings.ToLower(args.Pattern)
+	return func(n *Note) bool { return strings.Contains(strings.ToLower(visibleText(n)), pattern) }, nil
+}
+
+// RemoveMatching deletes every note whose text matches, or previews them on a dry run.
+func (s *NoteService) RemoveMatching(args MatchArgs, reply *CountReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	match, err := textMatcher(args)
+	if err != nil {
+		return err
+	}
+	if !args.DryRun {
+		if err := s.checkWritable(); err != nil {
+			return err
+		}
+	}
+
+	if args.DryRun {
+		for _, n := range s.notes {
+			if match(n) {
+				reply.Notes = append(reply.Notes, listed(n))
+			}
+		}
+		reply.Count = len(reply.Notes)
+		reply.Message = fmt.Sprintf("Would remove %d notes", reply.Count)
+		return nil
+	}
+
+	removed := s.removeWhere(match)
+	reply.Count = len(removed)
+	reply.Message = fmt.Sprintf("Removed %d notes", reply.Count)
+	if reply.Count > 0 {
+		s.checkAutoShutdown()
+	}
+	return nil
+}
+
+// RemoveUnpinned deletes every unpinned note, keeping the pinned ones.
+func (s *NoteService) RemoveUnpinned(args EmptyArgs, reply *CountReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	removed := s.removeWhere(func(n *Note) bool { return !n.Pinned })
+	reply.Count = len(removed)
+	reply.Message = fmt.Sprintf("Removed %d unpinned notes", reply.Count)
+	if reply.Count > 0 {
+		s.checkAutoShutdown() // Only fires when no pinned notes were left
+	}
+	return nil
+}
+
+// ClearOlderThan removes notes older than args.Age, sparing pinned ones unless IncludePinned is set.
+func (s *NoteService) ClearOlderThan(args DurationArgs, reply *CountReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	if args.Age <= 0 {
+		return fmt.Errorf("age must be positive")
+	}
+
+	cutoff := time.Now().Add(-args.Age)
+	removed := s.removeWhere(func(n *Note) bool {
+		return n.CreatedAt.Before(cutoff) && (args.IncludePinned || !n.Pinned)
+	})
+	reply.Count = len(removed)
+	reply.Message = fmt.Sprintf("Removed %d notes older than %s", reply.Count, args.Age)
+	if reply.Count > 0 {
+		s.checkAutoShutdown()
+	}
+	return nil
+}
+
+// Clear deletes everything. With Stop the daemon then shuts down; otherwise it
+// stays running, empty, for the next command.
+func (s *NoteService) Clear(args ClearArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	s.notes = []*Note{}
-	reply.Message = "All notes cleared."
+	s.keys = make(map[string]int)
+	if !args.Stop {
+		// The empty daemon stays up so the next command finds a session
+		reply.Message = "All notes cleared."
+		return nil
+	}
+	reply.Message = "All notes cleared. Session stopped."
 	s.checkAutoShutdown()
 	return nil
 }
 
 // Pin marks a note as important.
-func (s *NoteService) Pin(args IDArgs, reply *NoteReply) error {
+// With Exclusive, all other notes are unpinned so only this one stays pinned.
+func (s *NoteService) Pin(args PinArgs, reply *NoteReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	note, _, err := s.resolveID(args.IDStr)
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	note, idx, err := s.resolveID(args.IDStr)
 	if err != nil {
 		return err
 	}
+	if args.ToTop {
+		// Shift everything before it down one place; the note keeps this spot after unpinning
+		copy(s.notes[1:idx+1], s.notes[:idx])
+		s.notes[0] = note
+	}
+	now := time.Now()
+	if args.Exclusive {
+		for _, n := range s.notes {
+			if n.Pinned {
+				n.UpdatedAt = now
+			}
+			n.Pinned = false
+			n.PinReason = ""
+			n.PinnedAt = nil
+		}
+	}
 	note.Pinned = true
-	reply.Note = note
+	note.PinReason = args.Reason
+	note.PinnedAt = &now
+	note.UpdatedAt = now
+	reply.Note = snapshot(note)
 	reply.Message = fmt.Sprintf("Pinned note %d", note.ID)
 	return nil
 }
@@ -195,25 +1155,300 @@ func (s *NoteService) Unpin(args IDArgs, reply *NoteReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
 	note, _, err := s.resolveID(args.IDStr)
 	if err != nil {
 		return err
 	}
 	note.Pinned = false
-	reply.Note = note
+	note.PinReason = ""
+	note.PinnedAt = nil
+	note.UpdatedAt = time.Now()
+	reply.Note = snapshot(note)
 	reply.Message = fmt.Sprintf("Unpinned note %d", note.ID)
 	return nil
 }
 
+// Move repositions a note in the stored order, which is the order "list"
+// shows unpinned notes in. Pinned notes still sort first when listed.
+func (s *NoteService) Move(args MoveArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	note, idx, err := s.resolveID(args.IDStr)
+	if err != nil {
+		return err
+	}
+	target := idx + args.Offset
+	if args.Position != 0 {
+		target = args.Position - 1
+	}
+	target = max(0, min(target, len(s.notes)-1))
+
+	// Shift the notes in between by one place towards the gap
+	if target < idx {
+		copy(s.notes[target+1:idx+1], s.notes[target:idx])
+	} else {
+		copy(s.notes[idx:target], s.notes[idx+1:target+1])
+	}
+	s.notes[target] = note
+	reply.Note = snapshot(note)
+	reply.Message = fmt.Sprintf("Moved note %d to position %d", note.ID, target+1)
+	return nil
+}
+
+// SetAllPinned pins (or unpins) every note and reports how many changed.
+func (s *NoteService) SetAllPinned(args BoolArgs, reply *CountReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, n := range s.notes {
+		if n.Pinned == args.Value {
+			continue
+		}
+		n.Pinned = args.Value
+		n.PinReason = ""
+		n.PinnedAt = nil
+		if args.Value {
+			n.PinnedAt = &now
+		}
+		n.UpdatedAt = now
+		reply.Count++
+	}
+	verb := "Unpinned"
+	if args.Value {
+		verb = "Pinned"
+	}
+	reply.Message = fmt.Sprintf("%s %d notes", verb, reply.Count)
+	return nil
+}
+
 // Show returns details for a single note.
 func (s *NoteService) Show(args IDArgs, reply *NoteReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	note, idx, err := s.resolveID(args.IDStr)
+	if err != nil {
+		return err
+	}
+	if s.readOnly {
+		// Reading must not change anything: no view count, and no burning
+		if note.ExpireOnRead {
+			return fmt.Errorf("note %d can only be read once, which a read-only session does not allow", note.ID)
+		}
+		reply.Note = snapshot(note)
+		return nil
+	}
+	note.Views++
+	reply.Note = snapshot(note)
+
+	// Burn after reading: this is the only time the text is revealed
+	if note.ExpireOnRead {
+		s.notes = append(s.notes[:idx], s.notes[idx+1:]...)
+		s.forget(note.ID)
+		s.checkAutoShutdown()
+	}
+	return nil
+}
+
+// Get returns a single note without the side effects of Show: no view is
+// counted, and a read-once note is neither burned nor revealed.
+func (s *NoteService) Get(args IDArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	note, _, err := s.resolveID(args.IDStr)
 	if err != nil {
 		return err
 	}
-	reply.Note = note
+	c := listed(note)
+	reply.Note = &c
+	return nil
+}
+
+// computeStats gathers counts and the creation-time range over notes.
+func computeStats(notes []*Note) StatsReply {
+	st := StatsReply{NoteBytes: noteTextBytes(notes)}
+	for _, n := range notes {
+		st.Total++
+		if n.Pinned {
+			st.Pinned++
+		}
+		created := n.CreatedAt
+		if st.Oldest == nil || created.Before(*st.Oldest) {
+			st.Oldest = &created
+		}
+		if st.Newest == nil || created.After(*st.Newest) {
+			st.Newest = &created
+		}
+	}
+	return st
+}
+
+// Stats reports summary information about the session.
+func (s *NoteService) Stats(args EmptyArgs, reply *StatsReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	*reply = computeStats(s.notes)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	reply.MemBytes = mem.HeapAlloc
+	return nil
+}
+
+// Count reports just the number of notes, for cheap polling such as a shell prompt.
+func (s *NoteService) Count(args EmptyArgs, reply *CountReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply.Count = len(s.notes)
+	return nil
+}
+
+// Health reports that the daemon is up, for external monitoring.
+// It is strictly read-only and is not user activity: it changes no session
+// or note state, so probing it must never keep an otherwise idle session alive.
+func (s *NoteService) Health(args EmptyArgs, reply *HealthReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply.PID = os.Getpid()
+	reply.StartedAt = s.started
+	reply.Notes = len(s.notes)
+	return nil
+}
+
+// noteTextBytes estimates the memory held by notes as the total length of their text.
+func noteTextBytes(notes []*Note) int {
+	total := 0
+	for _, n := range notes {
+		total += len(n.Text)
+	}
+	return total
+}
+
+// addLink appends id to links unless it is already present.
+func addLink(links []int, id int) []int {
+	for _, l := range links {
+		if l == id {
+			return links
+		}
+	}
+	return append(links, id)
+}
+
+// removeLink returns links without id.
+func removeLink(links []int, id int) []int {
+	out := links[:0]
+	for _, l := range links {
+		if l != id {
+			out = append(out, l)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// resolvePair resolves both notes named in a LinkArgs and rejects self-references.
+func (s *NoteService) resolvePair(args LinkArgs) (*Note, *Note, error) {
+	from, _, err := s.resolveID(args.FromStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, _, err := s.resolveID(args.ToStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if from.ID == to.ID {
+		return nil, nil, fmt.Errorf("cannot link a note to itself")
+	}
+	return from, to, nil
+}
+
+// Link relates two notes to each other (in both directions).
+func (s *NoteService) Link(args LinkArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	from, to, err := s.resolvePair(args)
+	if err != nil {
+		return err
+	}
+	from.Links = addLink(from.Links, to.ID)
+	to.Links = addLink(to.Links, from.ID)
+	from.UpdatedAt = time.Now()
+	to.UpdatedAt = from.UpdatedAt
+	reply.Note = snapshot(from)
+	reply.Message = fmt.Sprintf("Linked note %d and note %d", from.ID, to.ID)
+	return nil
+}
+
+// Unlink removes the relation between two notes (in both directions).
+func (s *NoteService) Unlink(args LinkArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	from, to, err := s.resolvePair(args)
+	if err != nil {
+		return err
+	}
+	from.Links = removeLink(from.Links, to.ID)
+	to.Links = removeLink(to.Links, from.ID)
+	from.UpdatedAt = time.Now()
+	to.UpdatedAt = from.UpdatedAt
+	reply.Note = snapshot(from)
+	reply.Message = fmt.Sprintf("Unlinked note %d and note %d", from.ID, to.ID)
+	return nil
+}
+
+// SetTitle names the session so it can be told apart from others.
+func (s *NoteService) SetTitle(args TitleArgs, reply *NoteReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	s.title = strings.TrimSpace(args.Title)
+	if s.title == "" {
+		reply.Message = "Session title cleared."
+	} else {
+		reply.Message = fmt.Sprintf("Session title set to %q", s.title)
+	}
+	return nil
+}
+
+// GetTitle returns the session title (empty if unset).
+func (s *NoteService) GetTitle(args EmptyArgs, reply *TitleReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply.Title = s.title
 	return nil
 }
@@ -1,7 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -10,9 +21,148 @@ import (
 func setupTestService() *NoteService {
 	// We do not start the actual daemon (net.Listen) in tests.
 	// We just test the NoteService methods directly.
-	return &NoteService{
-		notes:  make([]*Note, 0),
-		nextID: 1,
+	s := newNoteService()
+	s.exit = func() {} // Never kill the test binary on auto-shutdown
+	return s
+}
+
+// TestStartDaemonInvalidSocket verifies an unusable socket path is reported as an error, not a panic.
+func TestStartDaemonInvalidSocket(t *testing.T) {
+	original := SocketPath
+	defer func() { SocketPath = original }()
+	SocketPath = filepath.Join(t.TempDir(), "missing", "cnote.sock")
+
+	if err := StartDaemon(); err == nil {
+		t.Fatal("Expected an error for an unwritable socket path")
+	}
+}
+
+// TestPIDFile verifies the PID file is written, replaced when stale, guarded when live, and removed on shutdown.
+func TestPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cnote.pid")
+	s := setupTestService()
+
+	// 1. Written on claim
+	if err := s.claimPIDFile(path); err != nil {
+		t.Fatalf("claimPIDFile failed: %v", err)
+	}
+	if pid, err := readPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Errorf("Expected our PID %d in the file, got %d (err %v)", os.Getpid(), pid, err)
+	}
+
+	// 2. Removed on shutdown
+	s.shutdown()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the PID file removed on shutdown, got %v", err)
+	}
+
+	// 3. A file naming a dead process is stale and replaced
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Skipf("cannot run a helper process: %v", err)
+	}
+	os.WriteFile(path, []byte(strconv.Itoa(dead.Process.Pid)+"\n"), 0o644)
+	if err := setupTestService().claimPIDFile(path); err != nil {
+		t.Errorf("Expected a stale PID file to be replaced, got %v", err)
+	}
+
+	// 4. A live process that is not a daemon (a reused PID) is stale too
+	other := exec.Command("sleep", "30")
+	if err := other.Start(); err != nil {
+		t.Skipf("cannot run a helper process: %v", err)
+	}
+	defer other.Process.Kill()
+	os.WriteFile(path, []byte(strconv.Itoa(other.Process.Pid)+"\n"), 0o644)
+	if err := setupTestService().claimPIDFile(path); err != nil {
+		t.Errorf("Expected a reused PID to be replaced, got %v", err)
+	}
+
+	// 5. A file naming a live daemon is refused
+	daemon := exec.Command("sh", "-c", "while :; do sleep 0.05; done", "daemon")
+	if err := daemon.Start(); err != nil {
+		t.Skipf("cannot run a helper process: %v", err)
+	}
+	defer daemon.Process.Kill()
+	if !isDaemonProcess(daemon.Process.Pid) {
+		t.Skip("process command lines are not readable here")
+	}
+	os.WriteFile(path, []byte(strconv.Itoa(daemon.Process.Pid)+"\n"), 0o644)
+	if err := setupTestService().claimPIDFile(path); err == nil || !strings.Contains(err.Error(), "another daemon") {
+		t.Errorf("Expected a live daemon to be refused, got %v", err)
+	}
+}
+
+// TestIsLiveDaemon verifies a PID counts as a daemon when the socket's daemon reports it.
+func TestIsLiveDaemon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cnote.sock")
+	server, l, err := listenDaemon(setupTestService(), path)
+	if err != nil {
+		t.Fatalf("listenDaemon failed: %v", err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	if !isLiveDaemon(os.Getpid(), path) {
+		t.Error("Expected the PID reported by Health to count as a live daemon")
+	}
+	if isLiveDaemon(os.Getppid(), path) && !isDaemonProcess(os.Getppid()) {
+		t.Error("Expected a PID the daemon does not report to be rejected")
+	}
+	if isLiveDaemon(os.Getpid(), filepath.Join(t.TempDir(), "none.sock")) && !isDaemonProcess(os.Getpid()) {
+		t.Error("Expected no daemon when nothing answers on the socket")
+	}
+}
+
+// TestDaemonRoundTrip runs a real daemon on a temporary socket and drives it with a real client.
+func TestDaemonRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cnote.sock")
+	service := setupTestService()
+	server, l, err := listenDaemon(service, path)
+	if err != nil {
+		t.Fatalf("listenDaemon failed: %v", err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	client, err := rpc.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	// 1. Add two notes over the socket
+	for _, text := range []string{"A", "B"} {
+		var reply NoteReply
+		if err := client.Call("NoteService.Add", AddArgs{Text: text}, &reply); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// 2. List them back
+	var list ListReply
+	if err := client.Call("NoteService.List", ListFilter{}, &list); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if got := noteIDs(list.Notes); !equalIDs(got, []int{1, 2}) {
+		t.Fatalf("Expected IDs [1 2], got %v", got)
+	}
+
+	// 3. Remove one and confirm it is gone
+	var reply NoteReply
+	if err := client.Call("NoteService.Remove", IDArgs{IDStr: "1"}, &reply); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	list = ListReply{}
+	if err := client.Call("NoteService.List", ListFilter{}, &list); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if got := noteIDs(list.Notes); !equalIDs(got, []int{2}) {
+		t.Errorf("Expected IDs [2] after removal, got %v", got)
+	}
+
+	// 4. Errors from the service reach the client
+	if err := client.Call("NoteService.Remove", IDArgs{IDStr: "9"}, &reply); err == nil {
+		t.Error("Expected an error removing a missing note")
 	}
 }
 
@@ -50,6 +200,150 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+// TestAddRejectsEmptyText verifies blank notes are refused.
+func TestAddRejectsEmptyText(t *testing.T) {
+	s := setupTestService()
+	if err := s.Add(AddArgs{Text: "   "}, &NoteReply{}); err == nil {
+		t.Error("Expected an error adding blank text")
+	}
+	if err := s.AddMany(AddManyArgs{Items: []AddArgs{{Text: "ok"}, {Text: ""}}}, &CountReply{}); err == nil {
+		t.Error("Expected an error adding a batch with blank text")
+	}
+	if len(s.notes) != 0 {
+		t.Errorf("Expected no notes after rejected adds, got %d", len(s.notes))
+	}
+}
+
+// TestAddDedupeWindow verifies duplicates are suppressed only within the window.
+func TestAddDedupeWindow(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "disk full"}, &NoteReply{}) // ID 1
+
+	// 1. Within the window: existing note is returned, nothing new is created
+	var reply NoteReply
+	if err := s.Add(AddArgs{Text: "disk full", DedupeWindow: 5 * time.Second}, &reply); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if reply.Note.ID != 1 || len(s.notes) != 1 {
+		t.Errorf("Expected duplicate to return ID 1 with 1 note, got ID %d with %d notes", reply.Note.ID, len(s.notes))
+	}
+
+	// 2. Outside the window: a new note is created
+	s.notes[0].CreatedAt = time.Now().Add(-10 * time.Second)
+	if err := s.Add(AddArgs{Text: "disk full", DedupeWindow: 5 * time.Second}, &reply); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if reply.Note.ID != 2 || len(s.notes) != 2 {
+		t.Errorf("Expected new note ID 2, got ID %d with %d notes", reply.Note.ID, len(s.notes))
+	}
+
+	// 3. Without a window, duplicates are always allowed
+	s.Add(AddArgs{Text: "disk full"}, &reply)
+	if reply.Note.ID != 3 {
+		t.Errorf("Expected new note ID 3 without a window, got %d", reply.Note.ID)
+	}
+}
+
+// TestAddExplicitID verifies a free ID is used and bumps nextID, while a taken one is rejected.
+func TestAddExplicitID(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+
+	var reply NoteReply
+	if err := s.Add(AddArgs{ID: 10, Text: "imported"}, &reply); err != nil {
+		t.Fatalf("Add with free ID failed: %v", err)
+	}
+	if reply.Note.ID != 10 || s.nextID != 11 {
+		t.Errorf("Expected ID 10 and nextID 11, got %d and %d", reply.Note.ID, s.nextID)
+	}
+
+	// A lower free ID does not move nextID backwards
+	s.Add(AddArgs{ID: 5, Text: "gap"}, &reply)
+	if reply.Note.ID != 5 || s.nextID != 11 {
+		t.Errorf("Expected ID 5 with nextID still 11, got %d and %d", reply.Note.ID, s.nextID)
+	}
+
+	if err := s.Add(AddArgs{ID: 1, Text: "clash"}, &reply); err == nil {
+		t.Error("Expected an error for a taken ID")
+	}
+	if err := s.AddMany(AddManyArgs{Items: []AddArgs{{ID: 20, Text: "x"}, {ID: 20, Text: "y"}}}, &CountReply{}); err == nil {
+		t.Error("Expected an error for a batch requesting the same ID twice")
+	}
+	if len(s.notes) != 3 {
+		t.Errorf("Expected 3 notes, got %d", len(s.notes))
+	}
+}
+
+// TestAddSource verifies each add path records where the note came from.
+func TestAddSource(t *testing.T) {
+	s := setupTestService()
+
+	var reply NoteReply
+	s.Add(AddArgs{Text: "typed"}, &reply)
+	if reply.Note.Source != "cli" {
+		t.Errorf("Expected default source 'cli', got %q", reply.Note.Source)
+	}
+
+	s.Add(AddArgs{Text: "piped", Source: addSource("-")}, &reply)
+	if reply.Note.Source != "stdin" {
+		t.Errorf("Expected 'add -' to record 'stdin', got %q", reply.Note.Source)
+	}
+
+	s.Add(AddArgs{Text: "literal", Source: addSource("literal")}, &reply)
+	if reply.Note.Source != "cli" {
+		t.Errorf("Expected an argument to record 'cli', got %q", reply.Note.Source)
+	}
+
+	s.AddMany(AddManyArgs{Items: []AddArgs{{Text: "line", Source: "stdin"}}}, &CountReply{})
+	if src := s.notes[len(s.notes)-1].Source; src != "stdin" {
+		t.Errorf("Expected --stdin-lines to record 'stdin', got %q", src)
+	}
+
+	s.Touch(EmptyArgs{}, &reply)
+	if reply.Note.Source != "cli" {
+		t.Errorf("Expected touch to record 'cli', got %q", reply.Note.Source)
+	}
+}
+
+// TestAddPinTop verifies --pin-top pins the note and inserts it at index 0.
+func TestAddPinTop(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+
+	var reply NoteReply
+	if err := s.Add(AddArgs{Text: "Urgent", Top: true}, &reply); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if !reply.Note.Pinned {
+		t.Error("Note added with Top should be pinned")
+	}
+	if s.notes[0].ID != 3 {
+		t.Errorf("Expected note 3 at index 0, got %d", s.notes[0].ID)
+	}
+	if len(s.notes) != 3 || s.notes[1].ID != 1 || s.notes[2].ID != 2 {
+		t.Errorf("Remaining notes out of order: %v", s.notes)
+	}
+}
+
+// TestAddMany verifies a batch is added in order and counted.
+func TestAddMany(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "existing"}, &NoteReply{}) // ID 1
+
+	var reply CountReply
+	err := s.AddMany(AddManyArgs{Items: []AddArgs{{Text: "A"}, {Text: "B"}}}, &reply)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+	if reply.Count != 2 {
+		t.Errorf("Expected count 2, got %d", reply.Count)
+	}
+	if len(s.notes) != 3 || s.notes[1].Text != "A" || s.notes[2].Text != "B" || s.notes[2].ID != 3 {
+		t.Errorf("Unexpected notes after AddMany: %v", s.notes)
+	}
+}
+
 // TestList verifies the List method returns the correct notes.
 func TestList(t *testing.T) {
 	s := setupTestService()
@@ -57,7 +351,7 @@ func TestList(t *testing.T) {
 	s.Add(AddArgs{Text: "N2"}, &NoteReply{})
 
 	var reply ListReply
-	err := s.List(EmptyArgs{}, &reply)
+	err := s.List(ListFilter{}, &reply)
 	if err != nil {
 		t.Fatalf("List failed: %v", err)
 	}
@@ -70,6 +364,44 @@ func TestList(t *testing.T) {
 	}
 }
 
+// TestListFilter verifies that combined filter fields are applied with AND semantics.
+func TestListFilter(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "Deploy API", Pinned: true}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "Deploy web"}, &NoteReply{})               // ID 2
+	s.Add(AddArgs{Text: "Buy milk", Pinned: true}, &NoteReply{})   // ID 3
+
+	// Backdate the first note so time filters can tell them apart
+	s.notes[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+
+	pinned := true
+	tests := []struct {
+		name     string
+		filter   ListFilter
+		expected []int
+	}{
+		{"NoFilter", ListFilter{}, []int{1, 2, 3}},
+		{"PinnedOnly", ListFilter{Pinned: &pinned}, []int{1, 3}},
+		{"TextOnly", ListFilter{Text: "deploy"}, []int{1, 2}},
+		{"PinnedAndText", ListFilter{Pinned: &pinned, Text: "deploy"}, []int{1}},
+		{"PinnedAndRecent", ListFilter{Pinned: &pinned, CreatedAfter: time.Now().Add(-time.Hour)}, []int{3}},
+		{"TextAndOld", ListFilter{Text: "deploy", CreatedBefore: time.Now().Add(-time.Hour)}, []int{1}},
+		{"NoMatch", ListFilter{Pinned: &pinned, Text: "web"}, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reply ListReply
+			if err := s.List(tt.filter, &reply); err != nil {
+				t.Fatalf("List failed: %v", err)
+			}
+			if got := noteIDs(reply.Notes); !equalIDs(got, tt.expected) {
+				t.Errorf("Expected IDs %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
 // TestIDResolution verifies the "first", "last", and numeric ID logic.
 func TestIDResolution(t *testing.T) {
 	s := setupTestService()
@@ -123,7 +455,7 @@ func TestPinAndUnpin(t *testing.T) {
 
 	// 1. Pin
 	var pinReply NoteReply
-	err := s.Pin(IDArgs{IDStr: "1"}, &pinReply)
+	err := s.Pin(PinArgs{IDStr: "1"}, &pinReply)
 	if err != nil {
 		t.Fatalf("Pin failed: %v", err)
 	}
@@ -142,6 +474,70 @@ func TestPinAndUnpin(t *testing.T) {
 	}
 }
 
+// TestPinReason verifies the reason is recorded on pin and cleared on unpin.
+func TestPinReason(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+
+	var reply NoteReply
+	if err := s.Pin(PinArgs{IDStr: "1", Reason: "blocking release"}, &reply); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	if reply.Note.PinReason != "blocking release" {
+		t.Errorf("Expected reason 'blocking release', got %q", reply.Note.PinReason)
+	}
+
+	if err := s.Unpin(IDArgs{IDStr: "1"}, &reply); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if reply.Note.PinReason != "" {
+		t.Errorf("Expected reason cleared on unpin, got %q", reply.Note.PinReason)
+	}
+
+	// An exclusive pin clears the reasons of the notes it unpins
+	s.Pin(PinArgs{IDStr: "1", Reason: "old"}, &NoteReply{})
+	s.Pin(PinArgs{IDStr: "2", Exclusive: true}, &NoteReply{})
+	if s.notes[0].PinReason != "" {
+		t.Errorf("Expected exclusive pin to clear note 1's reason, got %q", s.notes[0].PinReason)
+	}
+}
+
+// TestSetAllPinned verifies pin-all and unpin-all flip every note and count only the changes.
+func TestSetAllPinned(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})               // ID 1
+	s.Add(AddArgs{Text: "B", Pinned: true}, &NoteReply{}) // ID 2
+	s.Add(AddArgs{Text: "C"}, &NoteReply{})               // ID 3
+
+	var reply CountReply
+	if err := s.SetAllPinned(BoolArgs{Value: true}, &reply); err != nil {
+		t.Fatalf("SetAllPinned failed: %v", err)
+	}
+	if reply.Count != 2 {
+		t.Errorf("Expected 2 notes changed by pin-all, got %d", reply.Count)
+	}
+	for _, n := range s.notes {
+		if !n.Pinned || n.PinnedAt == nil {
+			t.Errorf("Note %d: expected pinned with a pin time", n.ID)
+		}
+	}
+
+	s.Pin(PinArgs{IDStr: "2", Reason: "keep"}, &NoteReply{})
+	reply = CountReply{}
+	if err := s.SetAllPinned(BoolArgs{Value: false}, &reply); err != nil {
+		t.Fatalf("SetAllPinned failed: %v", err)
+	}
+	if reply.Count != 3 {
+		t.Errorf("Expected 3 notes changed by unpin-all, got %d", reply.Count)
+	}
+	for _, n := range s.notes {
+		if n.Pinned || n.PinnedAt != nil || n.PinReason != "" {
+			t.Errorf("Note %d: expected fully unpinned, got %+v", n.ID, *n)
+		}
+	}
+}
+
 // TestRemove verifies note deletion and ID re-indexing logic.
 func TestRemove(t *testing.T) {
 	s := setupTestService()
@@ -172,7 +568,7 @@ func TestClear(t *testing.T) {
 	s.Add(AddArgs{Text: "A"}, &NoteReply{})
 	s.Add(AddArgs{Text: "B"}, &NoteReply{})
 
-	err := s.Clear(EmptyArgs{}, &NoteReply{})
+	err := s.Clear(ClearArgs{}, &NoteReply{})
 	if err != nil {
 		t.Fatalf("Clear failed: %v", err)
 	}
@@ -182,6 +578,39 @@ func TestClear(t *testing.T) {
 	}
 }
 
+// TestClearKeepAlive verifies Clear keeps the daemon running unless Stop is set.
+func TestClearKeepAlive(t *testing.T) {
+	s := setupTestService()
+	exited := make(chan struct{}, 1)
+	s.exit = func() { exited <- struct{}{} }
+
+	// 1. Keep-alive: emptied, but the session survives
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})
+	var reply NoteReply
+	if err := s.Clear(ClearArgs{}, &reply); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if len(s.notes) != 0 || reply.Message != "All notes cleared." {
+		t.Errorf("Expected an empty list and 'All notes cleared.', got %d notes and %q", len(s.notes), reply.Message)
+	}
+	select {
+	case <-exited:
+		t.Fatal("Expected the session to stay up after a keep-alive clear")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// 2. Stop: the session shuts down
+	s.Add(AddArgs{Text: "B"}, &NoteReply{})
+	if err := s.Clear(ClearArgs{Stop: true}, &reply); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the session to shut down after clear --stop")
+	}
+}
+
 // TestAutoShutdownLogic checks if the daemon correctly prepares to shut down.
 // NOTE: We cannot truly test os.Exit(0) in a unit test, so we verify the condition that
 // triggers shutdown (the note slice being empty after a deletion).
@@ -201,3 +630,1214 @@ func TestAutoShutdownLogic(t *testing.T) {
 	}
 	// In a real run, this completed the process, fulfilling the minimal requirement.
 }
+
+// TestStats verifies counts and the oldest/newest range.
+func TestStats(t *testing.T) {
+	s := setupTestService()
+
+	// 1. Empty session has no time range
+	var reply StatsReply
+	if err := s.Stats(EmptyArgs{}, &reply); err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if reply.Total != 0 || reply.Oldest != nil || reply.Newest != nil {
+		t.Errorf("Unexpected stats for empty session: %+v", reply)
+	}
+
+	// 2. Populated session
+	s.Add(AddArgs{Text: "A", Pinned: true}, &NoteReply{})
+	s.Add(AddArgs{Text: "B"}, &NoteReply{})
+	s.Add(AddArgs{Text: "C"}, &NoteReply{})
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.notes[0].CreatedAt = base.Add(time.Hour)
+	s.notes[1].CreatedAt = base
+	s.notes[2].CreatedAt = base.Add(2 * time.Hour)
+
+	if err := s.Stats(EmptyArgs{}, &reply); err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if reply.Total != 3 || reply.Pinned != 1 {
+		t.Errorf("Expected 3 total / 1 pinned, got %d / %d", reply.Total, reply.Pinned)
+	}
+	if !reply.Oldest.Equal(base) {
+		t.Errorf("Expected oldest %v, got %v", base, reply.Oldest)
+	}
+	if !reply.Newest.Equal(base.Add(2 * time.Hour)) {
+		t.Errorf("Expected newest %v, got %v", base.Add(2*time.Hour), reply.Newest)
+	}
+}
+
+// TestSince verifies only notes after the cursor are returned.
+func TestSince(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+	s.Add(AddArgs{Text: "C"}, &NoteReply{}) // ID 3
+
+	tests := []struct {
+		cursor   int
+		expected []int
+	}{
+		{0, []int{1, 2, 3}},  // First run shows everything
+		{1, []int{2, 3}},     // New since note 1
+		{3, []int{}},         // Nothing new
+		{10, []int{1, 2, 3}}, // Stale cursor from an older session
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Cursor:%d", tt.cursor), func(t *testing.T) {
+			var reply ListReply
+			if err := s.Since(SinceArgs{ID: tt.cursor}, &reply); err != nil {
+				t.Fatalf("Since failed: %v", err)
+			}
+			if got := noteIDs(reply.Notes); !equalIDs(got, tt.expected) {
+				t.Errorf("Expected IDs %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestLinkAndUnlink verifies links are validated and maintained in both directions.
+func TestLinkAndUnlink(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+
+	// 1. Link is bidirectional and not duplicated
+	for i := 0; i < 2; i++ {
+		if err := s.Link(LinkArgs{FromStr: "1", ToStr: "2"}, &NoteReply{}); err != nil {
+			t.Fatalf("Link failed: %v", err)
+		}
+	}
+	if !equalIDs(s.notes[0].Links, []int{2}) || !equalIDs(s.notes[1].Links, []int{1}) {
+		t.Errorf("Expected bidirectional links, got %v and %v", s.notes[0].Links, s.notes[1].Links)
+	}
+
+	// 2. Invalid targets are rejected
+	if err := s.Link(LinkArgs{FromStr: "1", ToStr: "9"}, &NoteReply{}); err == nil {
+		t.Error("Expected an error linking to a missing note")
+	}
+	if err := s.Link(LinkArgs{FromStr: "1", ToStr: "first"}, &NoteReply{}); err == nil {
+		t.Error("Expected an error linking a note to itself")
+	}
+
+	// 3. Unlink clears both sides
+	if err := s.Unlink(LinkArgs{FromStr: "2", ToStr: "1"}, &NoteReply{}); err != nil {
+		t.Fatalf("Unlink failed: %v", err)
+	}
+	if len(s.notes[0].Links) != 0 || len(s.notes[1].Links) != 0 {
+		t.Errorf("Expected no links after Unlink, got %v and %v", s.notes[0].Links, s.notes[1].Links)
+	}
+}
+
+// TestRemovePrunesLinks verifies removing a note drops dangling references from others.
+func TestRemovePrunesLinks(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+	s.Add(AddArgs{Text: "C"}, &NoteReply{}) // ID 3
+	s.Link(LinkArgs{FromStr: "1", ToStr: "2"}, &NoteReply{})
+	s.Link(LinkArgs{FromStr: "3", ToStr: "2"}, &NoteReply{})
+	s.Link(LinkArgs{FromStr: "1", ToStr: "3"}, &NoteReply{})
+
+	if err := s.Remove(IDArgs{IDStr: "2"}, &NoteReply{}); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if !equalIDs(s.notes[0].Links, []int{3}) {
+		t.Errorf("Expected note 1 links [3], got %v", s.notes[0].Links)
+	}
+	if !equalIDs(s.notes[1].Links, []int{1}) {
+		t.Errorf("Expected note 3 links [1], got %v", s.notes[1].Links)
+	}
+}
+
+// TestWebhookOnAdd verifies a new note is POSTed to the webhook as JSON.
+func TestWebhookOnAdd(t *testing.T) {
+	received := make(chan Note, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Note
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("Invalid webhook payload: %v", err)
+		}
+		received <- n
+	}))
+	defer srv.Close()
+
+	s := setupTestService()
+	s.webhook = srv.URL
+
+	var reply NoteReply
+	if err := s.Add(AddArgs{Text: "Ship it", Pinned: true}, &reply); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	select {
+	case n := <-received:
+		if n.ID != reply.Note.ID || n.Text != "Ship it" || !n.Pinned {
+			t.Errorf("Webhook payload %+v does not match added note %+v", n, *reply.Note)
+		}
+		if !n.CreatedAt.Equal(reply.Note.CreatedAt) {
+			t.Errorf("Expected CreatedAt %v, got %v", reply.Note.CreatedAt, n.CreatedAt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Webhook was not called")
+	}
+}
+
+// TestRemoveMatching verifies substring and regex bulk removal and the dry-run preview.
+func TestRemoveMatching(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "temp file"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "Keep me"}, &NoteReply{})   // ID 2
+	s.Add(AddArgs{Text: "TEMP dir"}, &NoteReply{})  // ID 3
+	s.Link(LinkArgs{FromStr: "1", ToStr: "2"}, &NoteReply{})
+
+	// 1. Dry run reports matches without removing them
+	var preview CountReply
+	if err := s.RemoveMatching(MatchArgs{Pattern: "temp", DryRun: true}, &preview); err != nil {
+		t.Fatalf("RemoveMatching dry run failed: %v", err)
+	}
+	if preview.Count != 2 || !equalIDs(noteIDs(preview.Notes), []int{1, 3}) {
+		t.Errorf("Expected preview of [1 3], got %d %v", preview.Count, noteIDs(preview.Notes))
+	}
+	if len(s.notes) != 3 {
+		t.Fatalf("Dry run must not remove notes, have %d", len(s.notes))
+	}
+
+	// 2. Real removal (case-insensitive substring)
+	var reply CountReply
+	if err := s.RemoveMatching(MatchArgs{Pattern: "temp"}, &reply); err != nil {
+		t.Fatalf("RemoveMatching failed: %v", err)
+	}
+	if reply.Count != 2 || len(s.notes) != 1 || s.notes[0].ID != 2 {
+		t.Errorf("Expected only note 2 to remain, got count %d and %v", reply.Count, s.notes)
+	}
+	if len(s.notes[0].Links) != 0 {
+		t.Errorf("Expected links to removed notes to be pruned, got %v", s.notes[0].Links)
+	}
+
+	// 3. Regex matching, and invalid patterns are rejected
+	if err := s.RemoveMatching(MatchArgs{Pattern: "^Keep", Regex: true}, &reply); err != nil {
+		t.Fatalf("RemoveMatching regex failed: %v", err)
+	}
+	if reply.Count != 1 || len(s.notes) != 0 {
+		t.Errorf("Expected regex to remove the last note, got count %d", reply.Count)
+	}
+	if err := s.RemoveMatching(MatchArgs{Pattern: "(", Regex: true}, &reply); err == nil {
+		t.Error("Expected an error for an invalid regex")
+	}
+}
+
+// TestFuzzyScore verifies subsequence matching and that closer matches rank higher.
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("grcy", "grocery"); !ok {
+		t.Error("Expected 'grcy' to match 'grocery'")
+	}
+	if _, ok := fuzzyScore("yrg", "grocery"); ok {
+		t.Error("Out-of-order characters must not match")
+	}
+
+	// Each candidate should outrank the next one
+	ranked := []string{"grocery list", "go buy groceries", "big rocky canyon"}
+	prev := -1 << 31
+	for i := len(ranked) - 1; i >= 0; i-- {
+		score, ok := fuzzyScore("groc", ranked[i])
+		if !ok {
+			t.Fatalf("Expected 'groc' to match %q", ranked[i])
+		}
+		if score <= prev {
+			t.Errorf("Expected %q (score %d) to outrank the next candidate (score %d)", ranked[i], score, prev)
+		}
+		prev = score
+	}
+}
+
+// TestSearch verifies plain results keep list order and fuzzy results are ranked.
+func TestSearch(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "big rocky canyon"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "Grocery run"}, &NoteReply{})      // ID 2
+	s.Add(AddArgs{Text: "call mom"}, &NoteReply{})         // ID 3
+
+	var reply ListReply
+	if err := s.Search(SearchArgs{Query: "ROC"}, &reply); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if got := noteIDs(reply.Notes); !equalIDs(got, []int{1, 2}) {
+		t.Errorf("Expected substring matches [1 2] in list order, got %v", got)
+	}
+
+	reply = ListReply{}
+	if err := s.Search(SearchArgs{Query: "groc", Fuzzy: true}, &reply); err != nil {
+		t.Fatalf("Fuzzy search failed: %v", err)
+	}
+	if got := noteIDs(reply.Notes); !equalIDs(got, []int{2, 1}) {
+		t.Errorf("Expected fuzzy ranking [2 1], got %v", got)
+	}
+
+	if err := s.Search(SearchArgs{}, &reply); err == nil {
+		t.Error("Expected an error for an empty query")
+	}
+}
+
+// TestTouchThenEdit verifies touch creates a placeholder that edit can fill.
+func TestTouchThenEdit(t *testing.T) {
+	s := setupTestService()
+
+	var touched NoteReply
+	if err := s.Touch(EmptyArgs{}, &touched); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if touched.Note.ID != 1 || touched.Note.Text != placeholderText {
+		t.Errorf("Expected placeholder note 1, got %+v", touched.Note)
+	}
+
+	var edited NoteReply
+	if err := s.Edit(EditArgs{IDStr: "1", Text: "Filled in"}, &edited); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	if s.notes[0].Text != "Filled in" {
+		t.Errorf("Expected edited text, got %q", s.notes[0].Text)
+	}
+
+	if err := s.Edit(EditArgs{IDStr: "1", Text: ""}, &edited); err == nil {
+		t.Error("Expected an error editing to blank text")
+	}
+	if err := s.Edit(EditArgs{IDStr: "2", Text: "x"}, &edited); err == nil {
+		t.Error("Expected an error editing a missing note")
+	}
+}
+
+// TestSessionTitle verifies the title is stored, cleared, and included in List replies.
+func TestSessionTitle(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})
+
+	if err := s.SetTitle(TitleArgs{Title: "  Sprint 12 notes "}, &NoteReply{}); err != nil {
+		t.Fatalf("SetTitle failed: %v", err)
+	}
+
+	var title TitleReply
+	if err := s.GetTitle(EmptyArgs{}, &title); err != nil {
+		t.Fatalf("GetTitle failed: %v", err)
+	}
+	if title.Title != "Sprint 12 notes" {
+		t.Errorf("Expected trimmed title, got %q", title.Title)
+	}
+
+	var list ListReply
+	s.List(ListFilter{}, &list)
+	if list.Title != "Sprint 12 notes" {
+		t.Errorf("Expected title in List reply, got %q", list.Title)
+	}
+
+	s.SetTitle(TitleArgs{}, &NoteReply{})
+	s.GetTitle(EmptyArgs{}, &title)
+	if title.Title != "" {
+		t.Errorf("Expected title to be cleared, got %q", title.Title)
+	}
+}
+
+// TestNoteTextBytes verifies the memory estimate sums note text lengths in bytes.
+func TestNoteTextBytes(t *testing.T) {
+	notes := []*Note{{Text: "abc"}, {Text: "héllo"}, {Text: ""}}
+	if got := noteTextBytes(notes); got != 9 { // "é" is two bytes
+		t.Errorf("Expected 9 bytes, got %d", got)
+	}
+
+	s := setupTestService()
+	s.Add(AddArgs{Text: "12345"}, &NoteReply{})
+	var reply StatsReply
+	s.Stats(EmptyArgs{}, &reply)
+	if reply.NoteBytes != 5 {
+		t.Errorf("Expected NoteBytes 5 in stats, got %d", reply.NoteBytes)
+	}
+	if reply.MemBytes == 0 {
+		t.Error("Expected a non-zero heap size in stats")
+	}
+}
+
+// TestPinExclusive verifies exclusive pinning leaves only the target pinned.
+func TestPinExclusive(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+	s.Add(AddArgs{Text: "C"}, &NoteReply{}) // ID 3
+
+	s.Pin(PinArgs{IDStr: "1"}, &NoteReply{})
+	s.Pin(PinArgs{IDStr: "3"}, &NoteReply{})
+	if err := s.Pin(PinArgs{IDStr: "2", Exclusive: true}, &NoteReply{}); err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+
+	for _, n := range s.notes {
+		if n.Pinned != (n.ID == 2) {
+			t.Errorf("Note %d: expected pinned=%v, got %v", n.ID, n.ID == 2, n.Pinned)
+		}
+	}
+
+	// A failed exclusive pin must not unpin anything
+	if err := s.Pin(PinArgs{IDStr: "9", Exclusive: true}, &NoteReply{}); err == nil {
+		t.Fatal("Expected an error pinning a missing note")
+	}
+	if !s.notes[1].Pinned {
+		t.Error("Failed exclusive pin should leave existing pins alone")
+	}
+}
+
+// TestClearOlderThan verifies the age cutoff and that pinned notes are spared by default.
+func TestClearOlderThan(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "old"}, &NoteReply{})                      // ID 1
+	s.Add(AddArgs{Text: "old pinned", Pinned: true}, &NoteReply{}) // ID 2
+	s.Add(AddArgs{Text: "fresh"}, &NoteReply{})                    // ID 3
+	s.notes[0].CreatedAt = time.Now().Add(-48 * time.Hour)
+	s.notes[1].CreatedAt = time.Now().Add(-48 * time.Hour)
+
+	// 1. Pinned notes survive by default
+	var reply CountReply
+	if err := s.ClearOlderThan(DurationArgs{Age: 24 * time.Hour}, &reply); err != nil {
+		t.Fatalf("ClearOlderThan failed: %v", err)
+	}
+	if reply.Count != 1 {
+		t.Errorf("Expected 1 note removed, got %d", reply.Count)
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{2, 3}) {
+		t.Errorf("Expected notes [2 3] to remain, got %v", got)
+	}
+
+	// 2. IncludePinned removes old pinned notes too
+	if err := s.ClearOlderThan(DurationArgs{Age: 24 * time.Hour, IncludePinned: true}, &reply); err != nil {
+		t.Fatalf("ClearOlderThan failed: %v", err)
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{3}) {
+		t.Errorf("Expected only note 3 to remain, got %v", got)
+	}
+
+	if err := s.ClearOlderThan(DurationArgs{}, &reply); err == nil {
+		t.Error("Expected an error for a zero age")
+	}
+}
+
+// TestAddLinkLast verifies LinkLast links the new note and the previous last one, and is a no-op on an empty list.
+func TestAddLinkLast(t *testing.T) {
+	s := setupTestService()
+
+	// 1. Empty list: nothing to link to
+	var reply NoteReply
+	if err := s.Add(AddArgs{Text: "step 1", LinkLast: true}, &reply); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if len(reply.Note.Links) != 0 {
+		t.Errorf("Expected no links on the first note, got %v", reply.Note.Links)
+	}
+
+	// 2. Each step links to the one before it
+	s.Add(AddArgs{Text: "step 2", LinkLast: true}, &reply)
+	s.Add(AddArgs{Text: "step 3", LinkLast: true}, &reply)
+	if !equalIDs(reply.Note.Links, []int{2}) {
+		t.Errorf("Expected note 3 linked to [2], got %v", reply.Note.Links)
+	}
+	if !equalIDs(s.notes[1].Links, []int{1, 3}) {
+		t.Errorf("Expected note 2 linked to [1 3], got %v", s.notes[1].Links)
+	}
+
+	// 3. Without the flag no link is made
+	s.Add(AddArgs{Text: "aside"}, &reply)
+	if len(reply.Note.Links) != 0 || !equalIDs(s.notes[2].Links, []int{2}) {
+		t.Errorf("Expected no new links, got %v and %v", reply.Note.Links, s.notes[2].Links)
+	}
+}
+
+// TestPinToTop verifies --to-top moves the note to the front while a plain pin leaves it in place.
+func TestPinToTop(t *testing.T) {
+	s := setupTestService()
+	for _, text := range []string{"A", "B", "C", "D"} {
+		s.Add(AddArgs{Text: text}, &NoteReply{})
+	}
+
+	// 1. Pin in place
+	s.Pin(PinArgs{IDStr: "3"}, &NoteReply{})
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{1, 2, 3, 4}) {
+		t.Errorf("Expected order [1 2 3 4] after a plain pin, got %v", got)
+	}
+
+	// 2. Pin with reposition, which survives unpinning
+	s.Pin(PinArgs{IDStr: "4", ToTop: true}, &NoteReply{})
+	s.Unpin(IDArgs{IDStr: "4"}, &NoteReply{})
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{4, 1, 2, 3}) {
+		t.Errorf("Expected order [4 1 2 3] after --to-top, got %v", got)
+	}
+	var reply NoteReply
+	s.Show(IDArgs{IDStr: "first"}, &reply)
+	if reply.Note.ID != 4 {
+		t.Errorf("Expected 'first' to be note 4, got %d", reply.Note.ID)
+	}
+}
+
+// TestMove verifies absolute and relative moves, clamped at both ends of the list.
+func TestMove(t *testing.T) {
+	s := setupTestService()
+	for _, text := range []string{"A", "B", "C", "D", "E"} {
+		s.Add(AddArgs{Text: text}, &NoteReply{})
+	}
+
+	tests := []struct {
+		name     string
+		args     MoveArgs
+		expected []int
+		position int
+	}{
+		{"Up one", MoveArgs{IDStr: "3", Offset: -1}, []int{1, 3, 2, 4, 5}, 2},
+		{"Down two", MoveArgs{IDStr: "1", Offset: 2}, []int{3, 2, 1, 4, 5}, 3},
+		{"Up past the top", MoveArgs{IDStr: "4", Offset: -10}, []int{4, 3, 2, 1, 5}, 1},
+		{"Down past the bottom", MoveArgs{IDStr: "first", Offset: 10}, []int{3, 2, 1, 5, 4}, 5},
+		{"Already first", MoveArgs{IDStr: "3", Offset: -1}, []int{3, 2, 1, 5, 4}, 1},
+		{"Absolute", MoveArgs{IDStr: "4", Position: 2}, []int{3, 4, 2, 1, 5}, 2},
+		{"Absolute past the end", MoveArgs{IDStr: "3", Position: 99}, []int{4, 2, 1, 5, 3}, 5},
+	}
+	for _, tt := range tests {
+		var reply NoteReply
+		if err := s.Move(tt.args, &reply); err != nil {
+			t.Fatalf("%s: Move failed: %v", tt.name, err)
+		}
+		if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, tt.expected) {
+			t.Errorf("%s: expected order %v, got %v", tt.name, tt.expected, got)
+		}
+		if want := fmt.Sprintf("Moved note %d to position %d", reply.Note.ID, tt.position); reply.Message != want {
+			t.Errorf("%s: expected %q, got %q", tt.name, want, reply.Message)
+		}
+	}
+
+	if err := s.Move(MoveArgs{IDStr: "42", Offset: 1}, &NoteReply{}); err == nil {
+		t.Error("Expected an error moving a missing note")
+	}
+}
+
+// TestRemoveUnpinned verifies only unpinned notes go, and the session survives while pinned ones remain.
+func TestRemoveUnpinned(t *testing.T) {
+	s := setupTestService()
+	exited := make(chan struct{}, 1)
+	s.exit = func() { exited <- struct{}{} }
+
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})               // ID 1
+	s.Add(AddArgs{Text: "B", Pinned: true}, &NoteReply{}) // ID 2
+	s.Add(AddArgs{Text: "C"}, &NoteReply{})               // ID 3
+	s.Link(LinkArgs{FromStr: "2", ToStr: "3"}, &NoteReply{})
+
+	// 1. Pinned notes survive, with links to removed notes pruned
+	var reply CountReply
+	if err := s.RemoveUnpinned(EmptyArgs{}, &reply); err != nil {
+		t.Fatalf("RemoveUnpinned failed: %v", err)
+	}
+	if reply.Count != 2 {
+		t.Errorf("Expected 2 notes removed, got %d", reply.Count)
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{2}) {
+		t.Errorf("Expected only note 2 to remain, got %v", got)
+	}
+	if len(s.notes[0].Links) != 0 {
+		t.Errorf("Expected links to removed notes pruned, got %v", s.notes[0].Links)
+	}
+
+	select {
+	case <-exited:
+		t.Fatal("Session shut down while a pinned note remained")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// 2. With nothing pinned, removing everything ends the session
+	s.Unpin(IDArgs{IDStr: "2"}, &NoteReply{})
+	if err := s.RemoveUnpinned(EmptyArgs{}, &reply); err != nil {
+		t.Fatalf("RemoveUnpinned failed: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the session to shut down once empty")
+	}
+}
+
+// TestShutdownIgnoresPins verifies both meanings of an empty session: by
+// default only a session without notes is empty, and with keepPinned any
+// pinned note keeps it alive as well.
+func TestShutdownIgnoresPins(t *testing.T) {
+	tests := []struct {
+		name       string
+		keepPinned bool
+		notes      []*Note
+		expected   bool
+	}{
+		{"No notes", false, nil, true},
+		{"Only pinned", false, []*Note{{ID: 1, Pinned: true}}, false},
+		{"Unpinned", false, []*Note{{ID: 1}}, false},
+		{"No notes, keeping pins", true, nil, true},
+		{"Only pinned, keeping pins", true, []*Note{{ID: 1, Pinned: true}}, false},
+		{"Unpinned, keeping pins", true, []*Note{{ID: 1}, {ID: 2, Pinned: true}}, false},
+	}
+	for _, tt := range tests {
+		s := setupTestService()
+		s.keepPinned = tt.keepPinned
+		s.notes = tt.notes
+		if got := s.empty(); got != tt.expected {
+			t.Errorf("%s: expected empty() = %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+
+	// Removing the last unpinned note never discards the pinned ones
+	for _, keep := range []bool{false, true} {
+		s := setupTestService()
+		s.keepPinned = keep
+		exited := make(chan struct{}, 1)
+		s.exit = func() { exited <- struct{}{} }
+		s.Add(AddArgs{Text: "A", Pinned: true}, &NoteReply{})
+		s.Add(AddArgs{Text: "B"}, &NoteReply{})
+		s.Remove(IDArgs{IDStr: "2"}, &NoteReply{})
+		select {
+		case <-exited:
+			t.Errorf("keepPinned=%v: session shut down while a pinned note remained", keep)
+		case <-time.After(300 * time.Millisecond):
+		}
+	}
+}
+
+// TestAddJSONBody verifies JSON-format notes are validated on add and edit.
+func TestAddJSONBody(t *testing.T) {
+	s := setupTestService()
+
+	var reply NoteReply
+	if err := s.Add(AddArgs{Text: `{"build": 42, "ok": true}`, Format: formatJSON}, &reply); err != nil {
+		t.Fatalf("Add with valid JSON failed: %v", err)
+	}
+	if reply.Note.Format != formatJSON {
+		t.Errorf("Expected format %q, got %q", formatJSON, reply.Note.Format)
+	}
+
+	if err := s.Add(AddArgs{Text: `{"build": 42,`, Format: formatJSON}, &NoteReply{}); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+	if err := s.AddMany(AddManyArgs{Items: []AddArgs{{Text: "[1]", Format: formatJSON}, {Text: "nope", Format: formatJSON}}}, &CountReply{}); err == nil {
+		t.Error("Expected AddMany to reject a batch with invalid JSON")
+	}
+	if len(s.notes) != 1 {
+		t.Errorf("Expected only the valid note to be stored, got %d notes", len(s.notes))
+	}
+
+	// Edits must keep the body valid
+	if err := s.Edit(EditArgs{IDStr: "1", Text: "not json"}, &NoteReply{}); err == nil {
+		t.Error("Expected Edit to reject invalid JSON for a JSON note")
+	}
+	if err := s.Edit(EditArgs{IDStr: "1", Text: `{"build": 43}`}, &NoteReply{}); err != nil {
+		t.Errorf("Edit with valid JSON failed: %v", err)
+	}
+
+	// Plain notes are unaffected
+	if err := s.Add(AddArgs{Text: "{not json"}, &NoteReply{}); err != nil {
+		t.Errorf("Plain note should not be validated as JSON: %v", err)
+	}
+}
+
+// TestClearThenAddSurvives verifies an Add landing during the shutdown delay keeps the session alive.
+func TestClearThenAddSurvives(t *testing.T) {
+	s := setupTestService()
+	exited := make(chan struct{}, 1)
+	s.exit = func() { exited <- struct{}{} }
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})
+
+	// A second client's Add races the pending shutdown from Clear
+	if err := s.Clear(ClearArgs{Stop: true}, &NoteReply{}); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if err := s.Add(AddArgs{Text: "B"}, &NoteReply{}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	select {
+	case <-exited:
+		t.Fatal("Session shut down although Add repopulated it")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// Once it stays empty, the session does shut down
+	s.Clear(ClearArgs{Stop: true}, &NoteReply{})
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the session to shut down once empty")
+	}
+}
+
+// TestExpireOnRead verifies a one-time note is hidden from listings and deleted by its first Show.
+func TestExpireOnRead(t *testing.T) {
+	s := setupTestService()
+	exited := make(chan struct{}, 1)
+	s.exit = func() { exited <- struct{}{} }
+
+	s.Add(AddArgs{Text: "plain"}, &NoteReply{})                           // ID 1
+	s.Add(AddArgs{Text: "hunter2", ExpireOnRead: true}, &NoteReply{})     // ID 2
+	s.Add(AddArgs{Text: "only secret", ExpireOnRead: true}, &NoteReply{}) // ID 3
+
+	// 1. List, search and matching never reveal the text
+	var list ListReply
+	s.List(ListFilter{}, &list)
+	if list.Notes[0].Text != "plain" || list.Notes[1].Text != hiddenText {
+		t.Errorf("Expected text masked in list, got %q and %q", list.Notes[0].Text, list.Notes[1].Text)
+	}
+	if s.Search(SearchArgs{Query: "hunter"}, &list); len(list.Notes) != 0 {
+		t.Errorf("Expected search not to match hidden text, got %v", noteIDs(list.Notes))
+	}
+	var preview CountReply
+	if s.RemoveMatching(MatchArgs{Pattern: "hunter", DryRun: true}, &preview); preview.Count != 0 {
+		t.Errorf("Expected --matching not to match hidden text, got %d", preview.Count)
+	}
+
+	// 2. Show reveals it once, then the note is gone
+	var reply NoteReply
+	if err := s.Show(IDArgs{IDStr: "2"}, &reply); err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	if reply.Note.Text != "hunter2" {
+		t.Errorf("Expected Show to reveal the text, got %q", reply.Note.Text)
+	}
+	if err := s.Show(IDArgs{IDStr: "2"}, &reply); err == nil {
+		t.Error("Expected the note to be deleted after the first Show")
+	}
+
+	// 3. Burning the last note ends the session
+	s.Remove(IDArgs{IDStr: "1"}, &NoteReply{})
+	if err := s.Show(IDArgs{IDStr: "3"}, &reply); err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the session to shut down once the last note burned")
+	}
+}
+
+// TestAddIdempotencyKey verifies a repeated key returns the original note until that note is removed.
+func TestAddIdempotencyKey(t *testing.T) {
+	s := setupTestService()
+
+	var first, second NoteReply
+	s.Add(AddArgs{Text: "deploy", IdempotencyKey: "deploy-123"}, &first)
+	if err := s.Add(AddArgs{Text: "deploy", IdempotencyKey: "deploy-123"}, &second); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if second.Note.ID != first.Note.ID || len(s.notes) != 1 {
+		t.Errorf("Expected the retry to return note %d without adding, got ID %d and %d notes", first.Note.ID, second.Note.ID, len(s.notes))
+	}
+
+	// A different key is a different note
+	s.Add(AddArgs{Text: "deploy", IdempotencyKey: "deploy-124"}, &second)
+	if second.Note.ID == first.Note.ID {
+		t.Error("Expected a new note for a different key")
+	}
+
+	// Removing the note frees its key
+	s.Remove(IDArgs{IDStr: "1"}, &NoteReply{})
+	if err := s.Add(AddArgs{Text: "deploy again", IdempotencyKey: "deploy-123"}, &second); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if second.Note.ID == first.Note.ID || second.Note.Text != "deploy again" {
+		t.Errorf("Expected a fresh note after the key's note was removed, got %+v", second.Note)
+	}
+	if _, ok := s.keys["deploy-124"]; !ok {
+		t.Error("Expected unrelated keys to survive a removal")
+	}
+}
+
+// TestAddRateLimit verifies bursts up to the bucket size pass, further adds are rejected, and tokens refill.
+func TestAddRateLimit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	s := setupTestService()
+	s.limiter = newRateLimiter(3, clock) // 3 adds/second, bursts of 3
+
+	for i := 0; i < 3; i++ {
+		if err := s.Add(AddArgs{Text: fmt.Sprintf("burst %d", i)}, &NoteReply{}); err != nil {
+			t.Fatalf("Add %d within the burst failed: %v", i, err)
+		}
+	}
+	err := s.Add(AddArgs{Text: "one too many"}, &NoteReply{})
+	if err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("Expected a rate limited error, got %v", err)
+	}
+	if len(s.notes) != 3 {
+		t.Errorf("Expected 3 notes stored, got %d", len(s.notes))
+	}
+
+	// Half a second later, one and a half tokens are back
+	now = now.Add(time.Second / 2)
+	if err := s.Add(AddArgs{Text: "refilled"}, &NoteReply{}); err != nil {
+		t.Errorf("Expected an add after refill, got %v", err)
+	}
+	if err := s.Add(AddArgs{Text: "again"}, &NoteReply{}); err == nil {
+		t.Error("Expected the refilled token to be spent")
+	}
+
+	// Suppressed duplicates and idempotent retries create nothing, so they are free
+	now = now.Add(time.Second / 3) // One token back
+	for i := 0; i < 5; i++ {
+		if err := s.Add(AddArgs{Text: "refilled", DedupeWindow: time.Minute}, &NoteReply{}); err != nil {
+			t.Fatalf("Expected a suppressed duplicate to pass the limiter, got %v", err)
+		}
+	}
+	if err := s.Add(AddArgs{Text: "real"}, &NoteReply{}); err != nil {
+		t.Errorf("Expected the token to be left for a real insert, got %v", err)
+	}
+
+	// Idle time never grows the bucket past its size
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		s.Add(AddArgs{Text: fmt.Sprintf("later %d", i)}, &NoteReply{})
+	}
+	if err := s.Add(AddArgs{Text: "over"}, &NoteReply{}); err == nil {
+		t.Error("Expected the burst to stay capped after a long idle period")
+	}
+}
+
+// TestAddManyRateLimit verifies a batch spends one token per note and is rejected whole when too large.
+func TestAddManyRateLimit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	s := setupTestService()
+	s.limiter = newRateLimiter(3, clock) // 3 adds/second, bursts of 3
+	batch := func(n int) AddManyArgs {
+		items := make([]AddArgs, n)
+		for i := range items {
+			items[i] = AddArgs{Text: fmt.Sprintf("line %d", i)}
+		}
+		return AddManyArgs{Items: items}
+	}
+
+	if err := s.AddMany(batch(2), &CountReply{}); err != nil {
+		t.Fatalf("AddMany within the burst failed: %v", err)
+	}
+	// One token left: a batch of two is refused and adds nothing
+	err := s.AddMany(batch(2), &CountReply{})
+	if err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("Expected a rate limited error, got %v", err)
+	}
+	if len(s.notes) != 2 {
+		t.Errorf("Expected 2 notes stored, got %d", len(s.notes))
+	}
+	// The refused batch spent nothing, and single adds share the bucket
+	if err := s.Add(AddArgs{Text: "single"}, &NoteReply{}); err != nil {
+		t.Errorf("Expected the remaining token to be usable, got %v", err)
+	}
+
+	// A batch bigger than the burst can never pass, and says so
+	now = now.Add(time.Hour)
+	err = s.AddMany(batch(4), &CountReply{})
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 3") {
+		t.Errorf("Expected an oversized batch to be refused, got %v", err)
+	}
+}
+
+// TestEditAppendPrepend verifies --append and --prepend extend the text with a single separator.
+func TestEditAppendPrepend(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "buy milk"}, &NoteReply{})
+	before := s.notes[0].UpdatedAt
+
+	var reply NoteReply
+	if err := s.Edit(EditArgs{IDStr: "1", Text: " and buy eggs", Append: true}, &reply); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if reply.Note.Text != "buy milk and buy eggs" {
+		t.Errorf("Expected 'buy milk and buy eggs', got %q", reply.Note.Text)
+	}
+	if !reply.Note.UpdatedAt.After(before) {
+		t.Error("Expected an append to bump UpdatedAt")
+	}
+
+	if err := s.Edit(EditArgs{IDStr: "1", Text: "Today:", Prepend: true}, &reply); err != nil {
+		t.Fatalf("Prepend failed: %v", err)
+	}
+	if reply.Note.Text != "Today: buy milk and buy eggs" {
+		t.Errorf("Expected 'Today: buy milk and buy eggs', got %q", reply.Note.Text)
+	}
+
+	if err := s.Edit(EditArgs{IDStr: "1", Text: "x", Append: true, Prepend: true}, &reply); err == nil {
+		t.Error("Expected an error when combining append and prepend")
+	}
+}
+
+// TestEditExpectedUpdatedAt verifies an edit against the current version succeeds and a stale one is rejected.
+func TestEditExpectedUpdatedAt(t *testing.T) {
+	s := setupTestService()
+	var added NoteReply
+	s.Add(AddArgs{Text: "draft"}, &added)
+	version := added.Note.UpdatedAt
+
+	// 1. Matching version: the edit goes through and bumps UpdatedAt
+	var reply NoteReply
+	if err := s.Edit(EditArgs{IDStr: "1", Text: "first", ExpectedUpdatedAt: version}, &reply); err != nil {
+		t.Fatalf("Edit with the current version failed: %v", err)
+	}
+	if !reply.Note.UpdatedAt.After(version) {
+		t.Errorf("Expected UpdatedAt to advance past %v, got %v", version, reply.Note.UpdatedAt)
+	}
+
+	// 2. Stale version: a second editor still holding the old one is refused
+	err := s.Edit(EditArgs{IDStr: "1", Text: "second", ExpectedUpdatedAt: version}, &NoteReply{})
+	if err == nil || !strings.Contains(err.Error(), "re-read") {
+		t.Errorf("Expected a conflict error, got %v", err)
+	}
+	if s.notes[0].Text != "first" {
+		t.Errorf("Expected the stale edit to leave 'first', got %q", s.notes[0].Text)
+	}
+
+	// Pinning is a change too
+	before := s.notes[0].UpdatedAt
+	s.Pin(PinArgs{IDStr: "1"}, &NoteReply{})
+	if err := s.Edit(EditArgs{IDStr: "1", Text: "third", ExpectedUpdatedAt: before}, &NoteReply{}); err == nil {
+		t.Error("Expected a conflict after the note was pinned")
+	}
+}
+
+// TestHealth verifies Health reports the daemon state without changing any of it.
+func TestHealth(t *testing.T) {
+	s := setupTestService()
+	s.started = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})
+	before := derefNotes(s.notes)
+
+	var reply HealthReply
+	if err := s.Health(EmptyArgs{}, &reply); err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if reply.PID != os.Getpid() || reply.Notes != 1 || !reply.StartedAt.Equal(s.started) {
+		t.Errorf("Unexpected health reply: %+v", reply)
+	}
+	if after := derefNotes(s.notes); !after[0].UpdatedAt.Equal(before[0].UpdatedAt) || len(after) != len(before) {
+		t.Error("Health must not modify notes")
+	}
+}
+
+// TestShowCountsViews verifies each Show increments the note's view counter.
+func TestShowCountsViews(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+
+	var reply NoteReply
+	for i := 1; i <= 3; i++ {
+		if err := s.Show(IDArgs{IDStr: "2"}, &reply); err != nil {
+			t.Fatalf("Show failed: %v", err)
+		}
+		if reply.Note.Views != i {
+			t.Errorf("After %d shows, expected %d views, got %d", i, i, reply.Note.Views)
+		}
+	}
+	if s.notes[0].Views != 0 {
+		t.Errorf("Expected unviewed note to have 0 views, got %d", s.notes[0].Views)
+	}
+
+	// list --sort views puts the most viewed note first
+	var list ListReply
+	s.List(ListFilter{}, &list)
+	sortByViews(list.Notes)
+	if got := noteIDs(list.Notes); !equalIDs(got, []int{2, 1}) {
+		t.Errorf("Expected order [2 1] by views, got %v", got)
+	}
+}
+
+// TestRestore verifies Restore replaces every note, keeps IDs and timestamps, and moves nextID past them.
+func TestRestore(t *testing.T) {
+	s := setupTestService()
+	for _, text := range []string{"A", "B", "C"} {
+		s.Add(AddArgs{Text: text, IdempotencyKey: text}, &NoteReply{}) // IDs 1-3
+	}
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	backup := []Note{
+		{ID: 7, Text: "seven", CreatedAt: created, Links: []int{12, 99}},
+		{ID: 12, Text: "twelve", Pinned: true, CreatedAt: created, Links: []int{7}},
+	}
+
+	var reply CountReply
+	if err := s.Restore(RestoreArgs{Notes: backup}, &reply); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if reply.Count != 2 {
+		t.Errorf("Expected 2 notes restored, got %d", reply.Count)
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{7, 12}) {
+		t.Errorf("Expected only the restored notes [7 12], got %v", got)
+	}
+	if !s.notes[0].CreatedAt.Equal(created) || !s.notes[1].Pinned {
+		t.Errorf("Expected timestamps and pin state preserved, got %+v", derefNotes(s.notes))
+	}
+	if !equalIDs(s.notes[0].Links, []int{12}) {
+		t.Errorf("Expected the dangling link to 99 dropped, got %v", s.notes[0].Links)
+	}
+	if s.findByKey("A") != nil {
+		t.Error("Expected idempotency keys of replaced notes to be forgotten")
+	}
+
+	// Links come back symmetric, without self-links or repeats
+	hand := []Note{
+		{ID: 1, Text: "a", Links: []int{2, 2, 1}},
+		{ID: 2, Text: "b"},
+		{ID: 3, Text: "c", Links: []int{1}},
+	}
+	other := setupTestService()
+	if err := other.Restore(RestoreArgs{Notes: hand}, &reply); err != nil {
+		t.Fatalf("Restore of linked notes failed: %v", err)
+	}
+	for i, want := range [][]int{{2, 3}, {1}, {1}} {
+		if got := other.notes[i].Links; !equalIDs(got, want) {
+			t.Errorf("Note %d: expected links %v, got %v", other.notes[i].ID, want, got)
+		}
+	}
+
+	// New notes continue after the highest restored ID
+	var added NoteReply
+	s.Add(AddArgs{Text: "next"}, &added)
+	if added.Note.ID != 13 {
+		t.Errorf("Expected next ID 13, got %d", added.Note.ID)
+	}
+
+	// Invalid input leaves the session untouched
+	if err := s.Restore(RestoreArgs{Notes: []Note{{ID: 1, Text: "x"}, {ID: 1, Text: "y"}}}, &reply); err == nil {
+		t.Error("Expected an error for duplicate IDs")
+	}
+	if err := s.Restore(RestoreArgs{Notes: []Note{{ID: 1, Text: "x", Format: "yaml"}}}, &reply); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if err := s.Restore(RestoreArgs{Notes: []Note{{ID: 1, Text: "{", Format: formatJSON}}}, &reply); err == nil {
+		t.Error("Expected an error for a JSON note with invalid text")
+	}
+	if len(s.notes) != 3 {
+		t.Errorf("Expected a failed restore to keep 3 notes, got %d", len(s.notes))
+	}
+}
+
+// derefNotes copies the service's note pointers into values for comparison helpers.
+func derefNotes(notes []*Note) []Note {
+	out := make([]Note, len(notes))
+	for i, n := range notes {
+		out[i] = *n
+	}
+	return out
+}
+
+// TestReadOnlyMode verifies mutating RPCs are rejected while reads keep working.
+func TestReadOnlyMode(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "shared"}, &NoteReply{}) // ID 1
+	s.readOnly = true
+
+	mutations := map[string]error{
+		"Add":            s.Add(AddArgs{Text: "x"}, &NoteReply{}),
+		"AddMany":        s.AddMany(AddManyArgs{Items: []AddArgs{{Text: "x"}}}, &CountReply{}),
+		"Touch":          s.Touch(EmptyArgs{}, &NoteReply{}),
+		"Edit":           s.Edit(EditArgs{IDStr: "1", Text: "x"}, &NoteReply{}),
+		"Remove":         s.Remove(IDArgs{IDStr: "1"}, &NoteReply{}),
+		"RemoveMatching": s.RemoveMatching(MatchArgs{Pattern: "shared"}, &CountReply{}),
+		"ClearOlderThan": s.ClearOlderThan(DurationArgs{Age: time.Nanosecond}, &CountReply{}),
+		"Clear":          s.Clear(ClearArgs{}, &NoteReply{}),
+		"Pin":            s.Pin(PinArgs{IDStr: "1"}, &NoteReply{}),
+		"Unpin":          s.Unpin(IDArgs{IDStr: "1"}, &NoteReply{}),
+		"Link":           s.Link(LinkArgs{FromStr: "1", ToStr: "1"}, &NoteReply{}),
+		"Unlink":         s.Unlink(LinkArgs{FromStr: "1", ToStr: "1"}, &NoteReply{}),
+		"SetTitle":       s.SetTitle(TitleArgs{Title: "x"}, &NoteReply{}),
+	}
+	for name, err := range mutations {
+		if err == nil || err.Error() != "session is read-only" {
+			t.Errorf("%s: expected read-only error, got %v", name, err)
+		}
+	}
+	if len(s.notes) != 1 || s.notes[0].Text != "shared" || s.notes[0].Pinned {
+		t.Errorf("State changed in read-only mode: %+v", s.notes)
+	}
+
+	reads := map[string]error{
+		"List":        s.List(ListFilter{}, &ListReply{}),
+		"Since":       s.Since(SinceArgs{}, &ListReply{}),
+		"Show":        s.Show(IDArgs{IDStr: "1"}, &NoteReply{}),
+		"Get":         s.Get(IDArgs{IDStr: "1"}, &NoteReply{}),
+		"Search":      s.Search(SearchArgs{Query: "shared"}, &ListReply{}),
+		"Stats":       s.Stats(EmptyArgs{}, &StatsReply{}),
+		"GetTitle":    s.GetTitle(EmptyArgs{}, &TitleReply{}),
+		"DryRunMatch": s.RemoveMatching(MatchArgs{Pattern: "shared", DryRun: true}, &CountReply{}),
+	}
+	for name, err := range reads {
+		if err != nil {
+			t.Errorf("%s: expected success in read-only mode, got %v", name, err)
+		}
+	}
+}
+
+// TestReadOnlyShow verifies a read-only Show neither counts a view nor burns a note.
+func TestReadOnlyShow(t *testing.T) {
+	s := setupTestService()
+	exited := make(chan struct{}, 1)
+	s.exit = func() { exited <- struct{}{} }
+	s.Add(AddArgs{Text: "shared"}, &NoteReply{})                     // ID 1
+	s.Add(AddArgs{Text: "secret", ExpireOnRead: true}, &NoteReply{}) // ID 2
+	s.readOnly = true
+
+	var reply NoteReply
+	if err := s.Show(IDArgs{IDStr: "1"}, &reply); err != nil || reply.Note.Text != "shared" {
+		t.Fatalf("Expected note 1 to be shown, got %+v, %v", reply.Note, err)
+	}
+	if s.notes[0].Views != 0 {
+		t.Errorf("Expected the view count to stay 0, got %d", s.notes[0].Views)
+	}
+
+	// The burn-after-read note is refused rather than revealed without burning
+	reply = NoteReply{}
+	if err := s.Show(IDArgs{IDStr: "2"}, &reply); err == nil || reply.Note != nil {
+		t.Errorf("Expected a read-once note to be refused, got %+v, %v", reply.Note, err)
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{1, 2}) || s.notes[1].Views != 0 {
+		t.Errorf("Expected both notes untouched, got %v", derefNotes(s.notes))
+	}
+	select {
+	case <-exited:
+		t.Error("A read-only Show shut the session down")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// TestDumpState verifies the SIGUSR1 snapshot lists every note with its pin state.
+func TestDumpState(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	notes := []*Note{
+		{ID: 1, Text: "buy milk", CreatedAt: created},
+		{ID: 3, Text: "call \"mom\"", Pinned: true, CreatedAt: created},
+		{ID: 4, Text: "the wifi password", ExpireOnRead: true, CreatedAt: created},
+	}
+
+	var b strings.Builder
+	dumpState(&b, "Groceries", 5, notes)
+	want := "state: 3 notes, next ID 5, title \"Groceries\"\n" +
+		"  #1 2024-05-01T09:30:00Z \"buy milk\"\n" +
+		"  #3 [pinned] 2024-05-01T09:30:00Z \"call \\\"mom\\\"\"\n" +
+		"  #4 2024-05-01T09:30:00Z " + strconv.Quote(hiddenText) + "\n"
+	if b.String() != want {
+		t.Errorf("Unexpected dump:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	dumpState(&b, "", 1, nil)
+	if b.String() != "state: 0 notes, next ID 1\n" {
+		t.Errorf("Unexpected empty dump: %q", b.String())
+	}
+}
+
+// TestConcurrentStress drives a real daemon with many clients running mixed
+// operations at once. Run it with -race: replies are encoded after s.mu is
+// released, so a reply that aliased a live note would show up as a race.
+func TestConcurrentStress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cnote.sock")
+	service := setupTestService()
+	service.Add(AddArgs{Text: "anchor", Pinned: true}, &NoteReply{})
+	server, l, err := listenDaemon(service, path)
+	if err != nil {
+		t.Fatalf("listenDaemon failed: %v", err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	const workers, rounds = 8, 40
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client, err := rpc.Dial("unix", path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer client.Close()
+			for i := range rounds {
+				var added NoteReply
+				if err := client.Call("NoteService.Add", AddArgs{Text: fmt.Sprintf("w%d-%d", w, i)}, &added); err != nil {
+					errs <- err
+					return
+				}
+				id := strconv.Itoa(added.Note.ID)
+				// Operations on notes other workers may have removed can fail; only the
+				// final state is checked.
+				client.Call("NoteService.Pin", PinArgs{IDStr: id}, &NoteReply{})
+				client.Call("NoteService.Link", LinkArgs{FromStr: "1", ToStr: id}, &NoteReply{})
+				client.Call("NoteService.Edit", EditArgs{IDStr: id, Text: "x", Append: true}, &NoteReply{})
+				client.Call("NoteService.Show", IDArgs{IDStr: "1"}, &NoteReply{})
+				client.Call("NoteService.List", ListFilter{}, &ListReply{})
+				client.Call("NoteService.Unpin", IDArgs{IDStr: id}, &NoteReply{})
+				if i%2 == 0 {
+					client.Call("NoteService.Unlink", LinkArgs{FromStr: "1", ToStr: id}, &NoteReply{})
+					client.Call("NoteService.Remove", IDArgs{IDStr: id}, &NoteReply{})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Worker failed: %v", err)
+	}
+
+	// Every other note per worker was removed, plus the anchor remains
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if want := 1 + workers*rounds/2; len(service.notes) != want {
+		t.Errorf("Expected %d notes, got %d", want, len(service.notes))
+	}
+}
+
+// TestAbstractSocket verifies "@" names skip file removal and keep their side files in the temp dir.
+func TestAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are Linux-only")
+	}
+	original := SocketPath
+	defer func() { SocketPath = original }()
+
+	tests := []struct {
+		path     string
+		abstract bool
+		pidFile  string
+	}{
+		{"/tmp/cnote.sock", false, "/tmp/cnote.pid"},
+		{"@cnote.sock", true, filepath.Join(os.TempDir(), "cnote.pid")},
+		{"@work", true, filepath.Join(os.TempDir(), "work.pid")},
+	}
+	for _, tt := range tests {
+		SocketPath = tt.path
+		if got := isAbstractSocket(tt.path); got != tt.abstract {
+			t.Errorf("isAbstractSocket(%q) = %v, expected %v", tt.path, got, tt.abstract)
+		}
+		if got := sidecarPath(".pid"); got != tt.pidFile {
+			t.Errorf("sidecarPath for %q = %q, expected %q", tt.path, got, tt.pidFile)
+		}
+	}
+
+	// A real daemon listens and serves without creating a file
+	name := "@cnote-test-" + strconv.Itoa(os.Getpid())
+	server, l, err := listenDaemon(setupTestService(), name)
+	if err != nil {
+		t.Fatalf("listenDaemon failed: %v", err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+	client, err := rpc.Dial("unix", name)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+	if err := client.Call("NoteService.Add", AddArgs{Text: "A"}, &NoteReply{}); err != nil {
+		t.Errorf("Add over abstract socket failed: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected no file for an abstract socket, got %v", err)
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"sort"
-	"text/tabwriter"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -18,6 +25,24 @@ func main() {
 		Long:    `cnote is an in-memory note tool. Notes persist only while the list is not empty.`,
 		Version: version,
 	}
+	rootCmd.PersistentFlags().BoolVar(&noSpawn, "no-spawn", false, "never start a session daemon; fail if none is running")
+	rootCmd.PersistentFlags().Bool("cwd-session", false, "use a separate session for the current directory (or set CNOTE_CWD_SESSION=1)")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		cwdFlag, err := cmd.Flags().GetBool("cwd-session")
+		if err != nil {
+			fmt.Println("Error retrieving cwd-session flag:", err)
+			os.Exit(1)
+		}
+		if !cwdFlag && os.Getenv("CNOTE_CWD_SESSION") != "1" {
+			return
+		}
+		path, err := cwdSocketPath()
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		useSocket(path)
+	}
 
 	// --- HIDDEN DAEMON COMMAND ---
 	// This is not meant to be run by humans. It is spawned by the client.
@@ -25,40 +50,225 @@ func main() {
 		Use:    "daemon",
 		Hidden: true,
 		Run: func(cmd *cobra.Command, args []string) {
-			StartDaemon()
+			// The spawning client relays stderr to the user
+			if err := StartDaemon(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
 		},
 	}
 
 	// --- ADD ---
 	var addCmd = &cobra.Command{
 		Use:   "add [note text]",
-		Short: "add a note (starts session if empty)",
-		Args:  cobra.ExactArgs(1),
+		Short: "add a note (starts session if empty; '-' reads stdin)",
+		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			client, err := getClient(true)
+			pinFlag, err := cmd.Flags().GetBool("pin")
 			if err != nil {
-				fmt.Println("Error:", err)
+				fmt.Println("Error retrieving pin flag:", err)
 				return
 			}
-			defer client.Close()
 
-			pinFlag, err := cmd.Flags().GetBool("pin")
+			pinTopFlag, err := cmd.Flags().GetBool("pin-top")
 			if err != nil {
-				fmt.Println("Error retrieving pin flag:", err)
+				fmt.Println("Error retrieving pin-top flag:", err)
+				return
+			}
+
+			teeFlag, err := cmd.Flags().GetBool("tee")
+			if err != nil {
+				fmt.Println("Error retrieving tee flag:", err)
+				return
+			}
+
+			stdinLinesFlag, err := cmd.Flags().GetBool("stdin-lines")
+			if err != nil {
+				fmt.Println("Error retrieving stdin-lines flag:", err)
+				return
+			}
+
+			jsonFlag, err := cmd.Flags().GetBool("json")
+			if err != nil {
+				fmt.Println("Error retrieving json flag:", err)
+				return
+			}
+
+			dedupeFlag, err := cmd.Flags().GetDuration("dedupe-window")
+			if err != nil {
+				fmt.Println("Error retrieving dedupe-window flag:", err)
+				return
+			}
+
+			idFlag, err := cmd.Flags().GetInt("id")
+			if err != nil {
+				fmt.Println("Error retrieving id flag:", err)
+				return
+			}
+
+			jsonBodyFlag, err := cmd.Flags().GetBool("json-body")
+			if err != nil {
+				fmt.Println("Error retrieving json-body flag:", err)
+				return
+			}
+			onceFlag, err := cmd.Flags().GetBool("once")
+			if err != nil {
+				fmt.Println("Error retrieving once flag:", err)
+				return
+			}
+
+			keyFlag, err := cmd.Flags().GetString("key")
+			if err != nil {
+				fmt.Println("Error retrieving key flag:", err)
+				return
+			}
+
+			prefixFlag, err := cmd.Flags().GetString("prefix")
+			if err != nil {
+				fmt.Println("Error retrieving prefix flag:", err)
+				return
+			}
+
+			suffixFlag, err := cmd.Flags().GetString("suffix")
+			if err != nil {
+				fmt.Println("Error retrieving suffix flag:", err)
+				return
+			}
+
+			printIDFlag, err := cmd.Flags().GetBool("print-id")
+			if err != nil {
+				fmt.Println("Error retrieving print-id flag:", err)
+				return
+			}
+
+			linkLastFlag, err := cmd.Flags().GetBool("link-last")
+			if err != nil {
+				fmt.Println("Error retrieving link-last flag:", err)
 				return
 			}
 
+			forceFlag, err := cmd.Flags().GetBool("force")
+			if err != nil {
+				fmt.Println("Error retrieving force flag:", err)
+				return
+			}
+
+			format := ""
+			if jsonBodyFlag {
+				format = formatJSON
+			}
+
+			clipboardFlag, err := cmd.Flags().GetBool("clipboard")
+			if err != nil {
+				fmt.Println("Error retrieving clipboard flag:", err)
+				return
+			}
+
+			// --stdin-lines or --clipboard replaces the text argument; otherwise exactly one is required
+			if clipboardFlag && stdinLinesFlag {
+				fmt.Println("Error: --clipboard cannot be combined with --stdin-lines")
+				return
+			}
+			if (stdinLinesFlag || clipboardFlag) != (len(args) == 0) {
+				fmt.Println("Error: provide note text, or use --stdin-lines or --clipboard without it")
+				return
+			}
+
+			if stdinLinesFlag {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					fmt.Println("Error: failed to read stdin:", err)
+					return
+				}
+				lines := splitLines(string(data))
+				if len(lines) == 0 {
+					fmt.Println("Error: no note text on stdin")
+					return
+				}
+
+				client, err := getClient(true)
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				defer client.Close()
+
+				items := make([]AddArgs, len(lines))
+				for i, line := range lines {
+					items[i] = AddArgs{Text: decorate(line, prefixFlag, suffixFlag), Pinned: pinFlag, Source: "stdin", Format: format}
+				}
+				var reply CountReply
+				if err := callRPC(client, "NoteService.AddMany", AddManyArgs{Items: items}, &reply); err != nil {
+					fmt.Println("RPC Error:", err)
+					return
+				}
+				fmt.Println(reply.Message)
+				return
+			}
+
+			// fail reports an error either as text or, with --json, as a JSON object on stderr.
+			// With --print-id nothing is printed, so a captured variable stays empty.
+			fail := func(prefix string, err error) {
+				if jsonFlag {
+					writeJSON(os.Stderr, jsonError{Error: err.Error()})
+					os.Exit(1)
+				}
+				if printIDFlag {
+					os.Exit(1)
+				}
+				fmt.Println(prefix, err)
+			}
+
+			var text, source string
+			if clipboardFlag {
+				text, err = readClipboard()
+				source = "clipboard"
+			} else {
+				text, err = readNoteText(args[0], os.Stdin)
+				source = addSource(args[0])
+			}
+			if err != nil {
+				fail("Error:", err)
+				return
+			}
+
+			// "cnote add remove" is usually a mistyped command, but it is still a valid note
+			if warning := mistypedCommand(text, cmd.Root()); warning != "" && !forceFlag {
+				fmt.Fprintln(os.Stderr, "Warning:", warning)
+			}
+
+			client, err := getClient(true)
+			if err != nil {
+				fail("Error:", err)
+				return
+			}
+			defer client.Close()
+
 			var reply NoteReply
-			err = client.Call("NoteService.Add", AddArgs{
-				Text:   args[0],
-				Pinned: pinFlag,
+			err = callRPC(client, "NoteService.Add", AddArgs{
+				ID:             idFlag,
+				Text:           decorate(text, prefixFlag, suffixFlag),
+				Pinned:         pinFlag,
+				Top:            pinTopFlag,
+				DedupeWindow:   dedupeFlag,
+				Source:         source,
+				Format:         format,
+				ExpireOnRead:   onceFlag,
+				LinkLast:       linkLastFlag,
+				IdempotencyKey: keyFlag,
 			}, &reply)
 
 			if err != nil {
-				fmt.Println("RPC Error:", err)
+				client.Close()
+				fail("RPC Error:", err)
 				return
 			}
-			fmt.Println(reply.Message)
+
+			if jsonFlag {
+				writeJSON(os.Stdout, reply.Note)
+				return
+			}
+			fmt.Println(addOutput(reply, teeFlag, printIDFlag))
 		},
 	}
 
@@ -68,6 +278,113 @@ func main() {
 		Aliases: []string{"ls"},
 		Short:   "list all notes",
 		Run: func(cmd *cobra.Command, args []string) {
+			reverseFlag, err := cmd.Flags().GetBool("reverse")
+			if err != nil {
+				fmt.Println("Error retrieving reverse flag:", err)
+				return
+			}
+
+			sinceLastFlag, err := cmd.Flags().GetBool("since-last")
+			if err != nil {
+				fmt.Println("Error retrieving since-last flag:", err)
+				return
+			}
+
+			showSourceFlag, err := cmd.Flags().GetBool("show-source")
+			if err != nil {
+				fmt.Println("Error retrieving show-source flag:", err)
+				return
+			}
+
+			wideFlag, err := cmd.Flags().GetBool("wide")
+			if err != nil {
+				fmt.Println("Error retrieving wide flag:", err)
+				return
+			}
+
+			noHeaderFlag, err := cmd.Flags().GetBool("no-header")
+			if err != nil {
+				fmt.Println("Error retrieving no-header flag:", err)
+				return
+			}
+
+			columnsFlag, err := cmd.Flags().GetString("columns")
+			if err != nil {
+				fmt.Println("Error retrieving columns flag:", err)
+				return
+			}
+			outputFlag, err := cmd.Flags().GetString("output")
+			if err != nil {
+				fmt.Println("Error retrieving output flag:", err)
+				return
+			}
+
+			pinnedFlag, err := cmd.Flags().GetBool("pinned")
+			if err != nil {
+				fmt.Println("Error retrieving pinned flag:", err)
+				return
+			}
+
+			countOnlyFlag, err := cmd.Flags().GetBool("count-only")
+			if err != nil {
+				fmt.Println("Error retrieving count-only flag:", err)
+				return
+			}
+
+			sortFlag, err := cmd.Flags().GetString("sort")
+			if err != nil {
+				fmt.Println("Error retrieving sort flag:", err)
+				return
+			}
+			if sortFlag != "default" && sortFlag != "views" && sortFlag != "score" {
+				fmt.Printf("Error: unknown sort %q (use default, views or score)\n", sortFlag)
+				return
+			}
+
+			var columns []string
+			if columnsFlag != "" {
+				if columns, err = parseColumns(columnsFlag); err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+			}
+
+			formatFlag, err := cmd.Flags().GetString("format")
+			if err != nil {
+				fmt.Println("Error retrieving format flag:", err)
+				return
+			}
+			if formatFlag != "table" && formatFlag != "csv" && formatFlag != "json" {
+				fmt.Printf("Error: unknown format %q (use table, csv or json)\n", formatFlag)
+				return
+			}
+
+			bareFlag, err := cmd.Flags().GetBool("bare")
+			if err != nil {
+				fmt.Println("Error retrieving bare flag:", err)
+				return
+			}
+			if bareFlag && formatFlag != "json" {
+				fmt.Println("Error: --bare only applies to --format json")
+				return
+			}
+
+			rawFlag, err := cmd.Flags().GetBool("raw")
+			if err != nil {
+				fmt.Println("Error retrieving raw flag:", err)
+				return
+			}
+
+			jsonStreamFlag, err := cmd.Flags().GetBool("json-stream")
+			if err != nil {
+				fmt.Println("Error retrieving json-stream flag:", err)
+				return
+			}
+			if jsonStreamFlag && cmd.Flags().Changed("format") {
+				fmt.Println("Error: --json-stream cannot be combined with --format")
+				return
+			}
+
 			client, err := getClient(false) // false = do not start daemon if missing
 			if err != nil {
 				fmt.Println("No active session.")
@@ -75,68 +392,123 @@ func main() {
 			}
 			defer client.Close()
 
+			var filter ListFilter
+			if pinnedFlag {
+				filter.Pinned = &pinnedFlag
+			}
+
 			var reply ListReply
-			err = client.Call("NoteService.List", EmptyArgs{}, &reply)
+			var cursor int
+			if sinceLastFlag {
+				// Only notes added after the saved cursor
+				cursor, err = readCursor(cursorPath())
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				err = callRPC(client, "NoteService.Since", SinceArgs{ID: cursor}, &reply)
+			} else {
+				err = callRPC(client, "NoteService.List", filter, &reply)
+			}
 			if err != nil {
 				fmt.Println("RPC Error:", err)
 				return
 			}
+			if sinceLastFlag {
+				reply.Notes = applyFilter(reply.Notes, filter) // Since does not filter
+			}
 
-			if len(reply.Notes) == 0 {
-				fmt.Println("No notes found.")
+			if countOnlyFlag {
+				// Just the number; a count is not a listing, so the cursor stays put
+				fmt.Println(len(reply.Notes))
 				return
 			}
 
-			// Sort notes: pinned ones first
-			sort.Slice(reply.Notes, func(i, j int) bool {
-				return reply.Notes[i].Pinned && !reply.Notes[j].Pinned
-			})
+			if sinceLastFlag {
+				// Advance the cursor past everything shown
+				if err := writeCursor(cursorPath(), maxNoteID(reply.Notes, cursor)); err != nil {
+					fmt.Println("Error:", err)
+				}
+			}
 
-			// Tabwriter for clean columns
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "ID\tPINNED\tCREATED\tCONTENT")
-			fmt.Fprintln(w, "--\t------\t-------\t-------")
-			for _, n := range reply.Notes {
-				pinMarker := ""
-				if n.Pinned {
-					pinMarker = "Yes"
+			// Sort notes: pinned ones first (or most viewed or hottest first), optionally reversed
+			switch sortFlag {
+			case "views", "score":
+				orderNotes(reply.Notes, false)
+				if sortFlag == "views" {
+					sortByViews(reply.Notes)
+				} else {
+					sortByScore(reply.Notes, time.Now())
 				}
-				dateStr := n.CreatedAt.Format("03:04PM")
-				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", n.ID, pinMarker, dateStr, n.Text)
+				if reverseFlag {
+					slices.Reverse(reply.Notes)
+				}
+			default:
+				orderNotes(reply.Notes, reverseFlag)
 			}
-			w.Flush()
-		},
-	}
 
-	// --- REMOVE ---
-	var removeCmd = &cobra.Command{
-		Use:     "remove [id]",
-		Aliases: []string{"rm"},
-		Short:   "remove a note ('first', 'last', or ID)",
-		Args:    cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			client, err := getClient(false)
+			out, closeOut, err := openOutput(outputFlag)
 			if err != nil {
-				fmt.Println("No active session.")
+				fmt.Println("Error:", err)
 				return
 			}
-			defer client.Close()
+			defer func() {
+				if err := closeOut(); err != nil {
+					fmt.Println("Error writing output:", err)
+				}
+			}()
 
-			var reply NoteReply
-			err = client.Call("NoteService.Remove", IDArgs{IDStr: args[0]}, &reply)
-			if err != nil {
-				fmt.Println("Error:", err) // Likely "ID not found"
+			if jsonStreamFlag {
+				if err := writeNotesNDJSON(out, reply.Notes); err != nil {
+					fmt.Println("Error:", err)
+				}
 				return
 			}
-			fmt.Println(reply.Message)
+
+			if formatFlag == "json" {
+				if err := writeNotesJSON(out, reply.Notes, bareFlag); err != nil {
+					fmt.Println("Error:", err)
+				}
+				return
+			}
+
+			if formatFlag == "csv" {
+				if err := writeNotesCSV(out, reply.Notes); err != nil {
+					fmt.Println("Error:", err)
+				}
+				return
+			}
+
+			if !noHeaderFlag {
+				printTitle(out, reply.Title) // The title is a header too
+			}
+			if len(reply.Notes) == 0 {
+				fmt.Fprintln(out, "No notes found.")
+				return
+			}
+			printNoteTable(out, reply.Notes, tableOptions{
+				Wide:       wideFlag,
+				ShowSource: showSourceFlag,
+				PinMarker:  pinMarker(),
+				NoHeader:   noHeaderFlag,
+				Columns:    columns,
+				Raw:        rawFlag,
+			})
 		},
 	}
 
-	// --- CLEAR ---
-	var clearCmd = &cobra.Command{
-		Use:   "clear",
-		Short: "clear all notes and stop session",
+	// --- SEARCH ---
+	var searchCmd = &cobra.Command{
+		Use:   "search [query]",
+		Short: "find notes containing text",
+		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			fuzzyFlag, err := cmd.Flags().GetBool("fuzzy")
+			if err != nil {
+				fmt.Println("Error retrieving fuzzy flag:", err)
+				return
+			}
+
 			client, err := getClient(false)
 			if err != nil {
 				fmt.Println("No active session.")
@@ -144,62 +516,1040 @@ func main() {
 			}
 			defer client.Close()
 
-			var reply NoteReply
-			err = client.Call("NoteService.Clear", EmptyArgs{}, &reply)
-			if err != nil {
+			var reply ListReply
+			if err := callRPC(client, "NoteService.Search", SearchArgs{Query: args[0], Fuzzy: fuzzyFlag}, &reply); err != nil {
 				fmt.Println("Error:", err)
 				return
 			}
-			fmt.Println(reply.Message)
+
+			if len(reply.Notes) == 0 {
+				fmt.Println("No matching notes.")
+				return
+			}
+			if !fuzzyFlag && isTerminal(os.Stdout) {
+				// Color each occurrence of the query; fuzzy matches are scattered, so left plain.
+				// The text is sanitized first so only the highlight's own escapes remain.
+				re := queryPattern(args[0])
+				for i := range reply.Notes {
+					reply.Notes[i].Text = highlight(sanitizeText(reply.Notes[i].Text), re)
+				}
+				printNoteTable(os.Stdout, reply.Notes, tableOptions{Wide: true, PinMarker: pinMarker(), Raw: true})
+				return
+			}
+			// Results keep the daemon's order: list order, or best match first with --fuzzy
+			printNoteTable(os.Stdout, reply.Notes, tableOptions{Wide: true, PinMarker: pinMarker()})
 		},
 	}
 
-	// --- PIN/UNPIN/SHOW Wrappers ---
-	// Helper to reduce code duplication for simple ID commands
-	runIDCommand := func(method string, id string) {
-		client, err := getClient(false)
-		if err != nil {
-			fmt.Println("No active session.")
-			return
-		}
-		defer client.Close()
-		var reply NoteReply
-		if err := client.Call(method, IDArgs{IDStr: id}, &reply); err != nil {
-			fmt.Println("Error:", err)
-			return
-		}
+	// --- REMOVE ---
+	var removeCmd = &cobra.Command{
+		Use:     "remove [id]",
+		Aliases: []string{"rm"},
+		Short:   "remove a note ('first', 'last', or ID; defaults to last)",
+		Args:    cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			matchingFlag, err := cmd.Flags().GetString("matching")
+			if err != nil {
+				fmt.Println("Error retrieving matching flag:", err)
+				return
+			}
 
-		if method == "NoteService.Show" {
-			n := reply.Note
-			fmt.Printf("--- Note %d ---\n", n.ID)
-			fmt.Printf("Pinned:  %s\n", map[bool]string{true: "Yes", false: "No"}[n.Pinned])
-			fmt.Printf("Created: %s\n", n.CreatedAt.Format("03:04PM"))
-			fmt.Printf("Content: %s\n", n.Text)
-		} else {
+			regexFlag, err := cmd.Flags().GetBool("regex")
+			if err != nil {
+				fmt.Println("Error retrieving regex flag:", err)
+				return
+			}
+
+			dryRunFlag, err := cmd.Flags().GetBool("dry-run")
+			if err != nil {
+				fmt.Println("Error retrieving dry-run flag:", err)
+				return
+			}
+
+			unpinnedFlag, err := cmd.Flags().GetBool("unpinned")
+			if err != nil {
+				fmt.Println("Error retrieving unpinned flag:", err)
+				return
+			}
+
+			jsonFlag, err := cmd.Flags().GetBool("json")
+			if err != nil {
+				fmt.Println("Error retrieving json flag:", err)
+				return
+			}
+
+			bulk := cmd.Flags().Changed("matching")
+			if bulk && len(args) > 0 {
+				fmt.Println("Error: --matching cannot be combined with an ID")
+				return
+			}
+			if unpinnedFlag && (bulk || len(args) > 0) {
+				fmt.Println("Error: --unpinned cannot be combined with an ID or --matching")
+				return
+			}
+			if !bulk && (regexFlag || dryRunFlag) {
+				fmt.Println("Error: --regex and --dry-run require --matching")
+				return
+			}
+			if jsonFlag && !dryRunFlag {
+				fmt.Println("Error: --json requires --dry-run")
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			if unpinnedFlag {
+				var reply CountReply
+				if err := callRPC(client, "NoteService.RemoveUnpinned", EmptyArgs{}, &reply); err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				fmt.Println(reply.Message)
+				return
+			}
+
+			if bulk {
+				var reply CountReply
+				err = callRPC(client, "NoteService.RemoveMatching", MatchArgs{
+					Pattern: matchingFlag,
+					Regex:   regexFlag,
+					DryRun:  dryRunFlag,
+				}, &reply)
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				if jsonFlag {
+					// Only the array, so a wrapper can parse it before confirming
+					if err := writePreviewJSON(os.Stdout, reply.Notes); err != nil {
+						fmt.Println("Error:", err)
+					}
+					return
+				}
+				fmt.Println(reply.Message)
+				if dryRunFlag {
+					printPreview(os.Stdout, reply.Notes)
+				}
+				return
+			}
+
+			var reply NoteReply
+			err = callRPC(client, "NoteService.Remove", IDArgs{IDStr: targetID(args)}, &reply)
+			if err != nil {
+				fmt.Println("Error:", err) // Likely "ID not found"
+				return
+			}
+			fmt.Println(successMessage("remove", reply))
+		},
+	}
+
+	// --- CLEAR ---
+	var clearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "clear all notes (--stop also ends the session)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			olderThanFlag, err := cmd.Flags().GetDuration("older-than")
+			if err != nil {
+				fmt.Println("Error retrieving older-than flag:", err)
+				return
+			}
+
+			includePinnedFlag, err := cmd.Flags().GetBool("include-pinned")
+			if err != nil {
+				fmt.Println("Error retrieving include-pinned flag:", err)
+				return
+			}
+
+			if includePinnedFlag && olderThanFlag == 0 {
+				fmt.Println("Error: --include-pinned requires --older-than")
+				return
+			}
+
+			stopFlag, err := cmd.Flags().GetBool("stop")
+			if err != nil {
+				fmt.Println("Error retrieving stop flag:", err)
+				return
+			}
+
+			noStopFlag, err := cmd.Flags().GetBool("no-stop")
+			if err != nil {
+				fmt.Println("Error retrieving no-stop flag:", err)
+				return
+			}
+
+			if stopFlag && noStopFlag {
+				fmt.Println("Error: --stop and --no-stop cannot be combined")
+				return
+			}
+			stop := clearStops(os.Getenv("CNOTE_CLEAR_STOP"), stopFlag, noStopFlag)
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			if olderThanFlag > 0 {
+				var reply CountReply
+				err = callRPC(client, "NoteService.ClearOlderThan", DurationArgs{
+					Age:           olderThanFlag,
+					IncludePinned: includePinnedFlag,
+				}, &reply)
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				fmt.Println(reply.Message)
+				return
+			}
+
+			var reply NoteReply
+			err = callRPC(client, "NoteService.Clear", ClearArgs{Stop: stop}, &reply)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println(reply.Message)
+		},
+	}
+
+	// --- PIN/UNPIN ---
+	// Helper to reduce code duplication for simple ID commands
+	runIDCommand := func(op, method, id string) {
+		client, err := getClient(false)
+		if err != nil {
+			fmt.Println("No active session.")
+			return
+		}
+		defer client.Close()
+		var reply NoteReply
+		if err := callRPC(client, method, IDArgs{IDStr: id}, &reply); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		fmt.Println(successMessage(op, reply))
+	}
+
+	var pinCmd = &cobra.Command{
+		Use:   "pin [id]",
+		Short: "pin a note (defaults to last)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			exclusiveFlag, err := cmd.Flags().GetBool("exclusive")
+			if err != nil {
+				fmt.Println("Error retrieving exclusive flag:", err)
+				return
+			}
+			reasonFlag, err := cmd.Flags().GetString("reason")
+			if err != nil {
+				fmt.Println("Error retrieving reason flag:", err)
+				return
+			}
+			toTopFlag, err := cmd.Flags().GetBool("to-top")
+			if err != nil {
+				fmt.Println("Error retrieving to-top flag:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			var reply NoteReply
+			if err := callRPC(client, "NoteService.Pin", PinArgs{
+				IDStr:     targetID(args),
+				Exclusive: exclusiveFlag,
+				Reason:    reasonFlag,
+				ToTop:     toTopFlag,
+			}, &reply); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println(successMessage("pin", reply))
+		},
+	}
+
+	var unpinCmd = &cobra.Command{
+		Use: "unpin [id]", Short: "unpin a note", Args: cobra.ExactArgs(1),
+		Run: func(c *cobra.Command, a []string) { runIDCommand("unpin", "NoteService.Unpin", a[0]) },
+	}
+
+	runSetAllPinned := func(pinned bool) {
+		client, err := getClient(false)
+		if err != nil {
+			fmt.Println("No active session.")
+			return
+		}
+		defer client.Close()
+		var reply CountReply
+		if err := callRPC(client, "NoteService.SetAllPinned", BoolArgs{Value: pinned}, &reply); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println(reply.Message)
+	}
+
+	var pinAllCmd = &cobra.Command{
+		Use: "pin-all", Short: "pin every note", Args: cobra.NoArgs,
+		Run: func(c *cobra.Command, a []string) { runSetAllPinned(true) },
+	}
+
+	var unpinAllCmd = &cobra.Command{
+		Use: "unpin-all", Short: "unpin every note", Args: cobra.NoArgs,
+		Run: func(c *cobra.Command, a []string) { runSetAllPinned(false) },
+	}
+
+	// --- SHOW ---
+	var showCmd = &cobra.Command{
+		Use:   "show [id]",
+		Short: "show full details (defaults to last)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			withAgeFlag, err := cmd.Flags().GetBool("with-age")
+			if err != nil {
+				fmt.Println("Error retrieving with-age flag:", err)
+				return
+			}
+
+			outputFlag, err := cmd.Flags().GetString("output")
+			if err != nil {
+				fmt.Println("Error retrieving output flag:", err)
+				return
+			}
+
+			neighborsFlag, err := cmd.Flags().GetBool("neighbors")
+			if err != nil {
+				fmt.Println("Error retrieving neighbors flag:", err)
+				return
+			}
+
+			markdownFlag, err := cmd.Flags().GetBool("markdown")
+			if err != nil {
+				fmt.Println("Error retrieving markdown flag:", err)
+				return
+			}
+
+			rawFlag, err := cmd.Flags().GetBool("raw")
+			if err != nil {
+				fmt.Println("Error retrieving raw flag:", err)
+				return
+			}
+
+			fieldFlag, err := cmd.Flags().GetString("field")
+			if err != nil {
+				fmt.Println("Error retrieving field flag:", err)
+				return
+			}
+			if fieldFlag != "" {
+				// Reject a bad name before the daemon is asked for the note
+				if _, err := noteField(&Note{}, fieldFlag); err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			err = runShow(client, targetID(args), showOptions{
+				Output:    outputFlag,
+				Field:     fieldFlag,
+				Neighbors: neighborsFlag,
+				Detail: detailOptions{
+					ShowAge:  withAgeFlag,
+					Now:      time.Now(),
+					Markdown: markdownFlag,
+					Raw:      rawFlag,
+				},
+			})
+			if err != nil {
+				fmt.Println("Error:", err)
+			}
+		},
+	}
+
+	// --- TOUCH ---
+	var touchCmd = &cobra.Command{
+		Use:   "touch",
+		Short: "add a placeholder note to fill in later with edit",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client, err := getClient(true)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			defer client.Close()
+
+			var reply NoteReply
+			if err := callRPC(client, "NoteService.Touch", EmptyArgs{}, &reply); err != nil {
+				fmt.Println("RPC Error:", err)
+				return
+			}
+			fmt.Println(reply.Message)
+		},
+	}
+
+	// --- EDIT ---
+	var editCmd = &cobra.Command{
+		Use:   "edit [id] [new text]",
+		Short: "replace (or append to) the text of a note",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			expectFlag, err := cmd.Flags().GetString("expect-updated")
+			if err != nil {
+				fmt.Println("Error retrieving expect-updated flag:", err)
+				return
+			}
+			var expected time.Time
+			if expectFlag != "" {
+				if expected, err = time.Parse(time.RFC3339Nano, expectFlag); err != nil {
+					fmt.Println("Error: --expect-updated wants a timestamp from 'cnote show --field updated_at'")
+					return
+				}
+			}
+
+			appendFlag, err := cmd.Flags().GetBool("append")
+			if err != nil {
+				fmt.Println("Error retrieving append flag:", err)
+				return
+			}
+
+			prependFlag, err := cmd.Flags().GetBool("prepend")
+			if err != nil {
+				fmt.Println("Error retrieving prepend flag:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			var reply NoteReply
+			if err := callRPC(client, "NoteService.Edit", EditArgs{
+				IDStr:             args[0],
+				Text:              args[1],
+				ExpectedUpdatedAt: expected,
+				Append:            appendFlag,
+				Prepend:           prependFlag,
+			}, &reply); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println(reply.Message)
+		},
+	}
+
+	// --- DIFF ---
+	var diffCmd = &cobra.Command{
+		Use:   "diff [id] [id]",
+		Short: "show a line diff between two notes",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			rawFlag, err := cmd.Flags().GetBool("raw")
+			if err != nil {
+				fmt.Println("Error retrieving raw flag:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			if err := runDiff(client, args[0], args[1], rawFlag, os.Stdout); err != nil {
+				fmt.Println("Error:", err)
+			}
+		},
+	}
+
+	// --- EXPORT ---
+	var exportCmd = &cobra.Command{
+		Use:   "export [file]",
+		Short: "write a snapshot of the notes to a file (or stdout)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			formatFlag, err := cmd.Flags().GetString("format")
+			if err != nil {
+				fmt.Println("Error retrieving format flag:", err)
+				return
+			}
+			if formatFlag != "json" && formatFlag != "html" {
+				fmt.Printf("Error: unknown format %q (use json or html)\n", formatFlag)
+				return
+			}
+
+			bareFlag, err := cmd.Flags().GetBool("bare")
+			if err != nil {
+				fmt.Println("Error retrieving bare flag:", err)
+				return
+			}
+			if bareFlag && formatFlag != "json" {
+				fmt.Println("Error: --bare only applies to --format json")
+				return
+			}
+
+			sinceIDFlag, err := cmd.Flags().GetInt("since-id")
+			if err != nil {
+				fmt.Println("Error retrieving since-id flag:", err)
+				return
+			}
+
+			incrementalFlag, err := cmd.Flags().GetBool("incremental")
+			if err != nil {
+				fmt.Println("Error retrieving incremental flag:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			var reply ListReply
+			var next int
+			if incrementalFlag || cmd.Flags().Changed("since-id") {
+				// Only notes added after the cursor; --since-id overrides the saved one
+				cursor := sinceIDFlag
+				if !cmd.Flags().Changed("since-id") {
+					cursor, err = readCursor(exportCursorPath())
+					if err != nil {
+						fmt.Println("Error:", err)
+						return
+					}
+				}
+				reply, next, err = exportSince(client, cursor)
+			} else {
+				err = callRPC(client, "NoteService.List", ListFilter{}, &reply)
+			}
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+
+			// advance saves the cursor once the notes are safely written
+			advance := func() {
+				if incrementalFlag {
+					if err := writeCursor(exportCursorPath(), next); err != nil {
+						fmt.Println("Error:", err)
+					}
+				}
+			}
+
+			if len(args) == 0 {
+				if err := writeExport(os.Stdout, formatFlag, reply, bareFlag); err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				advance()
+				return
+			}
+
+			f, err := os.Create(args[0])
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if err := writeExport(f, formatFlag, reply, bareFlag); err != nil {
+				f.Close()
+				fmt.Println("Error:", err)
+				return
+			}
+			if err := f.Close(); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			advance()
+			fmt.Printf("Exported %d notes to %s\n", len(reply.Notes), args[0])
+		},
+	}
+
+	var restoreCmd = &cobra.Command{
+		Use:   "restore-file [file]",
+		Short: "replace all notes with those in a JSON export",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			f, err := os.Open(args[0])
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			notes, err := readExport(f)
+			f.Close()
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if len(notes) == 0 {
+				fmt.Println("Error: the export holds no notes")
+				return
+			}
+
+			client, err := getClient(true)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			defer client.Close()
+
+			var reply CountReply
+			if err := callRPC(client, "NoteService.Restore", RestoreArgs{Notes: notes}, &reply); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println(reply.Message)
+		},
+	}
+
+	// --- LINK/UNLINK ---
+	runLinkCommand := func(method string, from, to string) {
+		client, err := getClient(false)
+		if err != nil {
+			fmt.Println("No active session.")
+			return
+		}
+		defer client.Close()
+		var reply NoteReply
+		if err := callRPC(client, method, LinkArgs{FromStr: from, ToStr: to}, &reply); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Println(reply.Message)
+	}
+
+	var linkCmd = &cobra.Command{
+		Use: "link [id] [id]", Short: "relate two notes", Args: cobra.ExactArgs(2),
+		Run: func(c *cobra.Command, a []string) { runLinkCommand("NoteService.Link", a[0], a[1]) },
+	}
+
+	var unlinkCmd = &cobra.Command{
+		Use: "unlink [id] [id]", Short: "remove the relation between two notes", Args: cobra.ExactArgs(2),
+		Run: func(c *cobra.Command, a []string) { runLinkCommand("NoteService.Unlink", a[0], a[1]) },
+	}
+
+	// --- MOVE ---
+	var moveCmd = &cobra.Command{
+		Use:   "move [id] [position | up|down [count]]",
+		Short: "move a note to a position, or up or down by a number of places",
+		Args:  cobra.RangeArgs(2, 3),
+		Run: func(cmd *cobra.Command, args []string) {
+			moveArgs, err := parseMove(args)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			var reply NoteReply
+			if err := callRPC(client, "NoteService.Move", moveArgs, &reply); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println(reply.Message)
+		},
+	}
+
+	// --- TITLE ---
+	var titleCmd = &cobra.Command{
+		Use:   "title [text]",
+		Short: "show or set the session title ('' clears it)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			if len(args) == 0 {
+				var reply TitleReply
+				if err := callRPC(client, "NoteService.GetTitle", EmptyArgs{}, &reply); err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				if reply.Title == "" {
+					fmt.Println("No session title.")
+					return
+				}
+				fmt.Println(reply.Title)
+				return
+			}
+
+			var reply NoteReply
+			if err := callRPC(client, "NoteService.SetTitle", TitleArgs{Title: args[0]}, &reply); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
 			fmt.Println(reply.Message)
-		}
+		},
 	}
 
-	var pinCmd = &cobra.Command{
-		Use: "pin [id]", Short: "pin a note", Args: cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, a []string) { runIDCommand("NoteService.Pin", a[0]) },
+	// --- WAIT ---
+	var waitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "block until the session ends",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			timeoutFlag, err := cmd.Flags().GetDuration("timeout")
+			if err != nil {
+				fmt.Println("Error retrieving timeout flag:", err)
+				return
+			}
+
+			if err := waitForShutdown(daemonAlive, 200*time.Millisecond, timeoutFlag); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
 	}
 
-	var unpinCmd = &cobra.Command{
-		Use: "unpin [id]", Short: "unpin a note", Args: cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, a []string) { runIDCommand("NoteService.Unpin", a[0]) },
+	// --- WATCH-FILE ---
+	var watchFileCmd = &cobra.Command{
+		Use:   "watch-file [file]",
+		Short: "mirror the lines of a file as notes, following changes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			intervalFlag, err := cmd.Flags().GetDuration("interval")
+			if err != nil {
+				fmt.Println("Error retrieving interval flag:", err)
+				return
+			}
+			if intervalFlag <= 0 {
+				fmt.Println("Error: --interval must be positive")
+				return
+			}
+
+			mirror := newFileMirror()
+			var modTime time.Time
+			for ; ; time.Sleep(intervalFlag) {
+				info, err := os.Stat(args[0])
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				if info.ModTime().Equal(modTime) {
+					continue
+				}
+				modTime = info.ModTime()
+
+				data, err := os.ReadFile(args[0])
+				if err != nil {
+					fmt.Println("Error:", err)
+					return
+				}
+				current := splitLines(string(data))
+				add, remove := syncOps(mirror.lines, current)
+				if len(add) == 0 && len(remove) == 0 {
+					continue
+				}
+
+				// Reconnect every sync: removing the last line ends the session
+				client, err := getClient(len(add) > 0)
+				if err != nil && len(add) == 0 {
+					// No session means the notes to remove are already gone
+					mirror = newFileMirror()
+					mirror.lines = current
+					continue
+				}
+				if err != nil {
+					fmt.Println("Error:", err)
+					modTime = time.Time{} // Retry on the next tick
+					continue
+				}
+				if err := mirror.sync(client, current, os.Stdout); err != nil {
+					fmt.Println("Error:", err)
+					modTime = time.Time{}
+				}
+				client.Close()
+			}
+		},
 	}
 
-	var showCmd = &cobra.Command{
-		Use: "show [id]", Short: "show full details", Args: cobra.ExactArgs(1),
-		Run: func(c *cobra.Command, a []string) { runIDCommand("NoteService.Show", a[0]) },
+	// --- LAST ---
+	var lastCmd = &cobra.Command{
+		Use:   "last",
+		Short: "print the most recent note",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fullFlag, err := cmd.Flags().GetBool("full")
+			if err != nil {
+				fmt.Println("Error retrieving full flag:", err)
+				return
+			}
+
+			rawFlag, err := cmd.Flags().GetBool("raw")
+			if err != nil {
+				fmt.Println("Error retrieving raw flag:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No notes.")
+				os.Exit(1)
+			}
+			defer client.Close()
+
+			if err := runLast(client, fullFlag, rawFlag, os.Stdout); err != nil {
+				if err == errNoNotes {
+					fmt.Println("No notes.")
+				} else {
+					fmt.Println("Error:", err)
+				}
+				client.Close()
+				os.Exit(1)
+			}
+		},
+	}
+
+	// --- COUNT ---
+	var countCmd = &cobra.Command{
+		Use:   "count",
+		Short: "print the number of notes",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			quietFlag, err := cmd.Flags().GetBool("quiet")
+			if err != nil {
+				fmt.Println("Error retrieving quiet flag:", err)
+				return
+			}
+
+			if err := runCount(quietFlag, os.Stdout); err != nil {
+				if err == errNoSession {
+					fmt.Println("No active session.")
+				} else {
+					fmt.Println("Error:", err)
+				}
+			}
+		},
+	}
+
+	// --- START ---
+	var startCmd = &cobra.Command{
+		Use:   "start",
+		Short: "make sure a session is running, without adding a note",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runStart(os.Stdout); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	// --- PURGE ---
+	var purgeCmd = &cobra.Command{
+		Use:   "purge",
+		Short: "stop every cnote daemon and remove leftover sockets and PID files",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			graceFlag, err := cmd.Flags().GetDuration("grace")
+			if err != nil {
+				fmt.Println("Error retrieving grace flag:", err)
+				return
+			}
+
+			// The default location, plus wherever this shell's settings point
+			dirs := []string{filepath.Dir(defaultSocketPath), filepath.Dir(pidFilePath())}
+			extra := []string{pidFilePath()}
+			if !isAbstractSocket(SocketPath) {
+				dirs = append(dirs, filepath.Dir(SocketPath))
+				extra = append(extra, SocketPath)
+			}
+			if purge(purgeCandidates(dirs, extra...), graceFlag, os.Stdout) == 0 {
+				fmt.Println("Nothing to purge.")
+			}
+		},
+	}
+
+	// --- SESSION-NAME ---
+	var sessionNameCmd = &cobra.Command{
+		Use:   "session-name",
+		Short: "print the session name --cwd-session uses for this directory",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := cwdSocketPath()
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Println(strings.TrimSuffix(filepath.Base(path), ".sock"))
+		},
+	}
+
+	// --- STATUS ---
+	var statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "show the daemon PID from its PID file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pid, err := readPIDFile(pidFilePath())
+			if err != nil || !isLiveDaemon(pid, SocketPath) {
+				fmt.Println("No active session.")
+				return
+			}
+			state := "running"
+			if !daemonAlive() {
+				state = "not responding"
+			}
+			fmt.Printf("Daemon pid %d (%s)\n", pid, state)
+		},
+	}
+
+	// --- HEALTH ---
+	var healthCmd = &cobra.Command{
+		Use:   "health",
+		Short: "check that the session daemon responds (exits 1 if not)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				os.Exit(1)
+			}
+			defer client.Close()
+
+			var reply HealthReply
+			if err := callRPC(client, "NoteService.Health", EmptyArgs{}, &reply); err != nil {
+				fmt.Println("Error:", err)
+				client.Close()
+				os.Exit(1)
+			}
+			fmt.Printf("ok: pid %d, up %s, %d notes\n", reply.PID, formatAge(time.Since(reply.StartedAt)), reply.Notes)
+		},
+	}
+
+	// --- STATS ---
+	var statsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "show session statistics",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			jsonFlag, err := cmd.Flags().GetBool("json")
+			if err != nil {
+				fmt.Println("Error retrieving json flag:", err)
+				return
+			}
+
+			client, err := getClient(false)
+			if err != nil {
+				fmt.Println("No active session.")
+				return
+			}
+			defer client.Close()
+
+			var reply StatsReply
+			if err := callRPC(client, "NoteService.Stats", EmptyArgs{}, &reply); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+
+			if jsonFlag {
+				writeJSON(os.Stdout, reply)
+				return
+			}
+			printStats(os.Stdout, reply)
+		},
 	}
 
 	// Register flag before Execute
 	addCmd.Flags().BoolP("pin", "p", false, "pin the note immediately")
+	addCmd.Flags().Bool("pin-top", false, "pin the note and place it first")
+	addCmd.Flags().Bool("tee", false, "print the stored text instead of the success message")
+	addCmd.Flags().Bool("link-last", false, "link the new note to the current last note")
+	addCmd.Flags().Bool("force", false, "do not warn when the text looks like a command or flag")
+	addCmd.Flags().Bool("print-id", false, "print only the new note's ID (nothing on failure)")
+	addCmd.Flags().Bool("clipboard", false, "use the clipboard contents (via wl-paste, xclip or xsel) as the note text")
+	addCmd.Flags().Bool("stdin-lines", false, "add one note per non-empty line of stdin")
+	addCmd.Flags().Bool("json", false, "print the new note as JSON instead of a message")
+	addCmd.Flags().Int("id", 0, "use this ID if it is free")
+	addCmd.Flags().Bool("json-body", false, "require the note text to be valid JSON")
+	addCmd.Flags().String("prefix", "", "prepend this to the note text")
+	addCmd.Flags().String("suffix", "", "append this to the note text")
+	addCmd.Flags().String("key", "", "idempotency key: rerunning with the same key reuses the note")
+	addCmd.Flags().Bool("once", false, "delete the note after it is first shown; list hides its text")
+	addCmd.Flags().Duration("dedupe-window", 0, "skip the add if identical text was added within this duration (e.g. 5s)")
+	searchCmd.Flags().Bool("fuzzy", false, "match characters in order and rank by closeness")
+	removeCmd.Flags().String("matching", "", "remove every note whose text contains this pattern")
+	removeCmd.Flags().Bool("regex", false, "treat --matching as a regular expression")
+	removeCmd.Flags().Bool("dry-run", false, "preview which notes would be removed")
+	removeCmd.Flags().Bool("json", false, "print the --dry-run preview as a JSON array")
+	removeCmd.Flags().Bool("unpinned", false, "remove every unpinned note, keeping pinned ones")
+	clearCmd.Flags().Duration("older-than", 0, "only remove notes older than this (e.g. 24h), keeping pinned ones")
+	clearCmd.Flags().Bool("include-pinned", false, "with --older-than, remove old pinned notes too")
+	clearCmd.Flags().Bool("stop", false, "also stop the daemon (the default when CNOTE_CLEAR_STOP=1)")
+	clearCmd.Flags().Bool("no-stop", false, "keep the empty daemon running for reuse (the default)")
+	listCmd.Flags().BoolP("reverse", "r", false, "reverse the display order")
+	listCmd.Flags().Bool("since-last", false, "only show notes added since the last --since-last listing")
+	listCmd.Flags().String("format", "table", "output format: table, csv or json")
+	listCmd.Flags().Bool("bare", false, "with --format json, print a plain array without the schema envelope")
+	listCmd.Flags().Bool("raw", false, "print note text as stored, including terminal escape sequences")
+	listCmd.Flags().Bool("json-stream", false, "print one JSON object per note per line (NDJSON)")
+	listCmd.Flags().Bool("show-source", false, "add a column showing how each note was added")
+	listCmd.Flags().BoolP("wide", "w", false, "include the pinned and created columns")
+	listCmd.Flags().Bool("no-header", false, "print only the data rows")
+	listCmd.Flags().String("columns", "", "comma-separated columns to show, in order (id, pinned, created, source, views, text)")
+	listCmd.Flags().StringP("output", "o", "", "write the listing to this file instead of stdout")
+	showCmd.Flags().StringP("output", "o", "", "write the note to this file instead of stdout")
+	listCmd.Flags().Bool("pinned", false, "only list pinned notes")
+	listCmd.Flags().Bool("count-only", false, "print only the number of matching notes")
+	listCmd.Flags().String("sort", "default", "order: default (pinned first), views (most viewed first) or score (recent and pinned first)")
+
+	pinCmd.Flags().Bool("exclusive", false, "unpin all other notes")
+	pinCmd.Flags().String("reason", "", "record why the note is pinned")
+	pinCmd.Flags().Bool("to-top", false, "also move the note to the front of the list, where it stays if unpinned")
+	showCmd.Flags().Bool("with-age", false, "include how long ago the note was created")
+	editCmd.Flags().Bool("append", false, "add the text to the end of the note instead of replacing it")
+	editCmd.Flags().Bool("prepend", false, "add the text to the start of the note instead of replacing it")
+	editCmd.Flags().String("expect-updated", "", "only edit if the note's updated_at still matches this value")
+	showCmd.Flags().Bool("neighbors", false, "also show the notes before and after it in list order")
+	showCmd.Flags().String("field", "", "print only this field (e.g. text, created_at)")
+	showCmd.Flags().Bool("raw", false, "print the content as stored, including terminal escape sequences")
+	lastCmd.Flags().Bool("raw", false, "print the note as stored, including terminal escape sequences")
+	diffCmd.Flags().Bool("raw", false, "compare the notes as stored, including terminal escape sequences")
+	showCmd.Flags().Bool("markdown", false, "render markdown in the content when writing to a terminal")
+	waitCmd.Flags().Duration("timeout", 0, "give up after this long (0 waits forever)")
+	watchFileCmd.Flags().Duration("interval", time.Second, "how often to check the file for changes")
+	lastCmd.Flags().Bool("full", false, "show full details instead of just the text")
+	statsCmd.Flags().Bool("json", false, "output statistics as JSON")
+	exportCmd.Flags().String("format", "json", "output format: json or html")
+	exportCmd.Flags().Bool("bare", false, "write JSON as a plain array without the schema envelope")
+	exportCmd.Flags().Int("since-id", 0, "only export notes with an ID greater than this")
+	exportCmd.Flags().Bool("incremental", false, "only export notes added since the last incremental export")
+	purgeCmd.Flags().Duration("grace", 2*time.Second, "how long a daemon gets to exit after SIGTERM before SIGKILL")
+	countCmd.Flags().BoolP("quiet", "q", false, "print 0 instead of an error when no session is running")
 
 	// Add all commands to rootCmd
-	rootCmd.AddCommand(daemonCmd, addCmd, listCmd, removeCmd, clearCmd, pinCmd, unpinCmd, showCmd)
+	rootCmd.AddCommand(daemonCmd, addCmd, listCmd, removeCmd, clearCmd, pinCmd, unpinCmd, pinAllCmd, unpinAllCmd, moveCmd, showCmd, lastCmd, countCmd, startCmd, statusCmd, sessionNameCmd, purgeCmd, healthCmd, statsCmd, linkCmd, unlinkCmd, searchCmd, touchCmd, editCmd, titleCmd, diffCmd, exportCmd, restoreCmd, waitCmd, watchFileCmd)
 
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
@@ -207,3 +1557,440 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// targetID returns the note selector given on the command line.
+// Commands that accept an optional ID fall back to the most recent note.
+func targetID(args []string) string {
+	if len(args) == 0 {
+		return "last"
+	}
+	return args[0]
+}
+
+// addSource names where the text for "add" came from.
+func addSource(arg string) string {
+	if arg == "-" {
+		return "stdin"
+	}
+	return "cli"
+}
+
+// readNoteText returns the note text for "add". The argument "-" means the
+// text is read from stdin, with the trailing newline removed.
+func readNoteText(arg string, stdin io.Reader) (string, error) {
+	if arg != "-" {
+		return arg, nil
+	}
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %v", err)
+	}
+	text := strings.TrimRight(string(data), "\r\n")
+	if text == "" {
+		return "", fmt.Errorf("no note text on stdin")
+	}
+	return text, nil
+}
+
+// clipboardCommand picks the command that prints the clipboard: the first of
+// the known tools that lookPath finds. wl-paste is only tried under Wayland,
+// where it comes first and the X tools still work through XWayland.
+func clipboardCommand(wayland bool, lookPath func(string) (string, error)) ([]string, error) {
+	tools := [][]string{
+		{"xclip", "-selection", "clipboard", "-o"},
+		{"xsel", "--clipboard", "--output"},
+	}
+	if wayland {
+		tools = append([][]string{{"wl-paste", "--no-newline"}}, tools...)
+	}
+	for _, tool := range tools {
+		if _, err := lookPath(tool[0]); err == nil {
+			return tool, nil
+		}
+	}
+	return nil, fmt.Errorf("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
+
+// readClipboard returns the clipboard contents as note text, with the
+// trailing newline removed.
+func readClipboard() (string, error) {
+	tool, err := clipboardCommand(os.Getenv("WAYLAND_DISPLAY") != "", exec.LookPath)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(tool[0], tool[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %v", tool[0], err)
+	}
+	text := strings.TrimRight(string(out), "\r\n")
+	if text == "" {
+		return "", fmt.Errorf("the clipboard is empty")
+	}
+	return text, nil
+}
+
+// mistypedCommand explains why note text looks like it was meant as a command
+// line rather than a note: it names one of root's subcommands or starts with
+// a dash. It returns "" for ordinary text.
+func mistypedCommand(text string, root *cobra.Command) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "-") {
+		return fmt.Sprintf("note text %q starts with a dash; did you mean a flag?", text)
+	}
+	for _, c := range root.Commands() {
+		if c.Name() == text || c.HasAlias(text) {
+			return fmt.Sprintf("note text %q is also a command; did you mean \"cnote %s\"?", text, text)
+		}
+	}
+	return ""
+}
+
+// errNoNotes signals that the session holds no notes.
+var errNoNotes = errors.New("no notes")
+
+// errNoSession signals that no daemon is running.
+var errNoSession = errors.New("no active session")
+
+// runCount prints the number of notes as a bare integer. It never starts a
+// daemon; with quiet, a missing session counts as 0 so it is safe in a prompt.
+func runCount(quiet bool, w io.Writer) error {
+	client, err := getClient(false)
+	if err != nil {
+		if quiet {
+			fmt.Fprintln(w, 0)
+			return nil
+		}
+		return errNoSession
+	}
+	defer client.Close()
+
+	var reply CountReply
+	if err := callRPC(client, "NoteService.Count", EmptyArgs{}, &reply); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, reply.Count)
+	return nil
+}
+
+// runStart connects to the session, spawning a daemon if none is running.
+// An empty daemon only shuts down once notes are removed or cleared with
+// --stop, so the session stays ready for the next command.
+func runStart(w io.Writer) error {
+	client, err := getClient(true)
+	if err != nil {
+		return err
+	}
+	client.Close()
+	fmt.Fprintln(w, "Session ready.")
+	return nil
+}
+
+// runLast prints the most recent note: just its text, or the detailed view when full is set.
+// Like show, terminal escape sequences are stripped unless raw is set.
+// An empty list yields errNoNotes so the caller can exit non-zero.
+func runLast(client rpcCaller, full, raw bool, w io.Writer) error {
+	var reply NoteReply
+	if err := callRPC(client, "NoteService.Show", IDArgs{IDStr: "last"}, &reply); err != nil {
+		if err.Error() == "list is empty" {
+			return errNoNotes
+		}
+		return err
+	}
+
+	text := reply.Note.Text
+	if !raw {
+		text = sanitizeText(text)
+	}
+	if full {
+		printNoteDetails(w, reply.Note, detailOptions{Raw: raw, Burned: reply.Note.ExpireOnRead})
+	} else {
+		fmt.Fprintln(w, text)
+	}
+	return nil
+}
+
+// runDiff prints a line diff between two notes. They are fetched with Get, so
+// comparing counts no views; read-once notes are refused, as only show may
+// read them. Like show, escape sequences are stripped unless raw is set.
+func runDiff(client rpcCaller, idA, idB string, raw bool, w io.Writer) error {
+	var a, b NoteReply
+	if err := callRPC(client, "NoteService.Get", IDArgs{IDStr: idA}, &a); err != nil {
+		return err
+	}
+	if err := callRPC(client, "NoteService.Get", IDArgs{IDStr: idB}, &b); err != nil {
+		return err
+	}
+	for _, n := range []*Note{a.Note, b.Note} {
+		if n.ExpireOnRead {
+			return fmt.Errorf("note %d can only be read once; use 'cnote show %d' to read it", n.ID, n.ID)
+		}
+	}
+
+	fmt.Fprintf(w, "--- Note %d\n+++ Note %d\n", a.Note.ID, b.Note.ID)
+	textA, textB := a.Note.Text, b.Note.Text
+	if !raw {
+		textA, textB = sanitizeText(textA), sanitizeText(textB)
+	}
+	for _, line := range lineDiff(textA, textB) {
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// showOptions carries the flags of "show".
+type showOptions struct {
+	Output    string        // Write to this file instead of stdout
+	Field     string        // Print only this field of the note
+	Neighbors bool          // Also print the notes before and after it
+	Detail    detailOptions // Markdown only applies when writing to a terminal
+}
+
+// runShow prints one note in detail. The output is opened before the note is
+// fetched: showing has side effects (a view, or burning a read-once note), so
+// a bad --output path must fail first rather than lose the text.
+func runShow(client rpcCaller, id string, opts showOptions) (err error) {
+	out, closeOut, err := openOutput(opts.Output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closeOut(); cerr != nil && err == nil {
+			err = fmt.Errorf("writing output: %v", cerr)
+		}
+	}()
+
+	// Context comes from a list taken before the read, which still holds
+	// a read-once note that Show is about to delete
+	var list ListReply
+	if opts.Neighbors {
+		if err := callRPC(client, "NoteService.List", ListFilter{}, &list); err != nil {
+			return err
+		}
+		orderNotes(list.Notes, false)
+	}
+
+	var reply NoteReply
+	if err := callRPC(client, "NoteService.Show", IDArgs{IDStr: id}, &reply); err != nil {
+		return err
+	}
+
+	if opts.Field != "" {
+		value, _ := noteField(reply.Note, opts.Field)
+		fmt.Fprintln(out, value)
+		return nil
+	}
+	// Styles only help a terminal; pipes and files get the raw text
+	detail := opts.Detail
+	detail.Markdown = detail.Markdown && isTerminal(out)
+	shown := detail
+	shown.Burned = reply.Note.ExpireOnRead // Show only returns a read-once note by deleting it
+	if !opts.Neighbors {
+		printNoteDetails(out, reply.Note, shown)
+		return nil
+	}
+
+	// The notes around this one, in list order; neighbors only carry the masked text
+	window := neighborWindow(list.Notes, reply.Note.ID)
+	if window == nil {
+		window = []Note{*reply.Note} // Added after the list was taken
+	}
+	for i, n := range window {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if n.ID == reply.Note.ID {
+			printNoteDetails(out, reply.Note, shown)
+		} else {
+			printNoteDetails(out, &n, detail)
+		}
+	}
+	return nil
+}
+
+// exportSince fetches the notes added after cursor for an incremental export,
+// along with the cursor to save once they have been written.
+func exportSince(client rpcCaller, cursor int) (ListReply, int, error) {
+	var reply ListReply
+	if err := callRPC(client, "NoteService.Since", SinceArgs{ID: cursor}, &reply); err != nil {
+		return reply, cursor, err
+	}
+	return reply, maxNoteID(reply.Notes, cursor), nil
+}
+
+// openOutput returns where a command's rendered output goes: stdout when path
+// is empty, otherwise the file at path, created or truncated. The returned
+// close function flushes and closes the file, reporting any write error.
+func openOutput(path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(f)
+	return w, func() error {
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+// applyFilter keeps the notes that satisfy a ListFilter, for replies the daemon did not filter.
+func applyFilter(notes []Note, f ListFilter) []Note {
+	kept := notes[:0]
+	for i := range notes {
+		if f.matches(&notes[i]) {
+			kept = append(kept, notes[i])
+		}
+	}
+	return kept
+}
+
+// parseMove turns "move" arguments into MoveArgs: "ID POSITION" for an
+// absolute move, or "ID up|down [COUNT]" for a relative one (COUNT defaults to 1).
+func parseMove(args []string) (MoveArgs, error) {
+	moveArgs := MoveArgs{IDStr: args[0]}
+	direction := strings.ToLower(args[1])
+	if direction != "up" && direction != "down" {
+		if len(args) > 2 {
+			return MoveArgs{}, fmt.Errorf("a count only follows up or down")
+		}
+		pos, err := strconv.Atoi(args[1])
+		if err != nil || pos < 1 {
+			return MoveArgs{}, fmt.Errorf("invalid position %q (use a number from 1, up or down)", args[1])
+		}
+		moveArgs.Position = pos
+		return moveArgs, nil
+	}
+
+	count := 1
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return MoveArgs{}, fmt.Errorf("invalid count %q", args[2])
+		}
+		count = n
+	}
+	if direction == "up" {
+		count = -count
+	}
+	moveArgs.Offset = count
+	return moveArgs, nil
+}
+
+// decorate wraps note text in the --prefix and --suffix strings.
+func decorate(text, prefix, suffix string) string {
+	return prefix + text + suffix
+}
+
+// clearStops decides whether "clear" also stops the daemon: --stop or
+// --no-stop when given, otherwise CNOTE_CLEAR_STOP=1 makes stopping the default.
+func clearStops(env string, stop, noStop bool) bool {
+	if stop || noStop {
+		return stop
+	}
+	return env == "1"
+}
+
+// syncOps compares two versions of a mirrored file and returns the lines to
+// add as notes and the lines whose notes should be removed. Lines are matched
+// as a multiset, so a moved line is left alone and a duplicated one is added once more.
+func syncOps(old, current []string) (add, remove []string) {
+	count := make(map[string]int)
+	for _, line := range old {
+		count[line]++
+	}
+	for _, line := range current {
+		if count[line] > 0 {
+			count[line]--
+		} else {
+			add = append(add, line)
+		}
+	}
+	// Whatever is left over was deleted from the file
+	for _, line := range old {
+		if count[line] > 0 {
+			count[line]--
+			remove = append(remove, line)
+		}
+	}
+	return add, remove
+}
+
+// fileMirror is the state of "watch-file": the file lines that have notes,
+// the IDs of those notes (oldest first per line), and the daemon holding them.
+type fileMirror struct {
+	lines  []string
+	ids    map[string][]int
+	daemon HealthReply
+}
+
+// newFileMirror returns a mirror that has not synced anything yet.
+func newFileMirror() *fileMirror {
+	return &fileMirror{ids: make(map[string][]int)}
+}
+
+// sync brings the session in line with the current file lines and reports
+// each change to w. A line is only recorded once its note was added (and
+// dropped once removed), so failed calls are retried on the next change. If
+// the daemon was replaced since the last sync, the recorded IDs may belong to
+// unrelated notes, so the mirror starts over and adds every line again.
+func (m *fileMirror) sync(client rpcCaller, current []string, w io.Writer) error {
+	var health HealthReply
+	if err := callRPC(client, "NoteService.Health", EmptyArgs{}, &health); err != nil {
+		return err
+	}
+	if m.daemon.PID != 0 && (health.PID != m.daemon.PID || !health.StartedAt.Equal(m.daemon.StartedAt)) {
+		m.lines, m.ids = nil, make(map[string][]int)
+	}
+	m.daemon = health
+
+	add, remove := syncOps(m.lines, current)
+	for _, line := range remove {
+		if len(m.ids[line]) == 0 {
+			// Its note was never recorded (say the session was gone), so there is nothing to remove
+			m.forget(line)
+			continue
+		}
+		id := m.ids[line][0]
+		if err := callRPC(client, "NoteService.Remove", IDArgs{IDStr: strconv.Itoa(id)}, &NoteReply{}); err != nil {
+			fmt.Fprintln(w, "Error:", err)
+			continue
+		}
+		m.ids[line] = m.ids[line][1:]
+		m.forget(line)
+		fmt.Fprintf(w, "- %d  %s\n", id, line)
+	}
+	for _, line := range add {
+		var reply NoteReply
+		if err := callRPC(client, "NoteService.Add", AddArgs{Text: line, Source: "file"}, &reply); err != nil {
+			fmt.Fprintln(w, "Error:", err)
+			continue
+		}
+		m.lines = append(m.lines, line)
+		m.ids[line] = append(m.ids[line], reply.Note.ID)
+		fmt.Fprintf(w, "+ %d  %s\n", reply.Note.ID, line)
+	}
+	return nil
+}
+
+// forget drops one occurrence of line from the mirrored lines.
+func (m *fileMirror) forget(line string) {
+	if i := slices.Index(m.lines, line); i >= 0 {
+		m.lines = slices.Delete(m.lines, i, i+1)
+	}
+}
+
+// splitLines breaks text into trimmed, non-empty lines.
+func splitLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// TestTargetID verifies optional ID arguments default to "last".
+func TestTargetID(t *testing.T) {
+	if got := targetID(nil); got != "last" {
+		t.Errorf("Expected default 'last', got %q", got)
+	}
+	if got := targetID([]string{"3"}); got != "3" {
+		t.Errorf("Expected explicit ID '3', got %q", got)
+	}
+
+	// The default must resolve to the most recently added note
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{}) // ID 1
+	s.Add(AddArgs{Text: "B"}, &NoteReply{}) // ID 2
+
+	note, _, err := s.resolveID(targetID([]string{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if note.ID != 2 {
+		t.Errorf("Expected default to resolve to ID 2, got %d", note.ID)
+	}
+}
+
+// TestReadNoteText verifies "-" reads the note from stdin and other arguments pass through.
+func TestReadNoteText(t *testing.T) {
+	text, err := readNoteText("-", strings.NewReader("from pipe\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if text != "from pipe" {
+		t.Errorf("Expected 'from pipe', got %q", text)
+	}
+
+	text, err = readNoteText("literal", strings.NewReader("ignored"))
+	if err != nil || text != "literal" {
+		t.Errorf("Expected literal argument, got %q (err %v)", text, err)
+	}
+
+	if _, err := readNoteText("-", strings.NewReader("\n")); err == nil {
+		t.Error("Expected an error for empty stdin")
+	}
+}
+
+// TestRunLast verifies the last command prints the newest note via the Show RPC.
+func TestRunLast(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "older"}, &NoteReply{})
+	s.Add(AddArgs{Text: "newest"}, &NoteReply{})
+
+	// Route fake RPC calls straight into the service
+	client := &fakeClient{handle: func(method string, args any, reply any) error {
+		if method != "NoteService.Show" {
+			t.Fatalf("Unexpected method %s", method)
+		}
+		if id := args.(IDArgs).IDStr; id != "last" {
+			t.Fatalf("Expected IDStr 'last', got %q", id)
+		}
+		return s.Show(args.(IDArgs), reply.(*NoteReply))
+	}}
+
+	// 1. Text only
+	var out bytes.Buffer
+	if err := runLast(client, false, false, &out); err != nil {
+		t.Fatalf("runLast failed: %v", err)
+	}
+	if out.String() != "newest\n" {
+		t.Errorf("Expected 'newest', got %q", out.String())
+	}
+
+	// 2. Full details
+	out.Reset()
+	if err := runLast(client, true, false, &out); err != nil {
+		t.Fatalf("runLast failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "--- Note 2 ---") {
+		t.Errorf("Expected detailed view, got %q", out.String())
+	}
+
+	// 3. Escape sequences are stripped unless raw is set
+	s.Add(AddArgs{Text: "\x1b[31mred\x1b[0m"}, &NoteReply{})
+	out.Reset()
+	runLast(client, false, false, &out)
+	if out.String() != "red\n" {
+		t.Errorf("Expected sanitized text, got %q", out.String())
+	}
+	out.Reset()
+	runLast(client, false, true, &out)
+	if out.String() != "\x1b[31mred\x1b[0m\n" {
+		t.Errorf("Expected raw text, got %q", out.String())
+	}
+
+	// 4. Empty list is an error
+	s.Clear(ClearArgs{}, &NoteReply{})
+	if err := runLast(client, false, false, &out); err != errNoNotes {
+		t.Errorf("Expected errNoNotes, got %v", err)
+	}
+}
+
+// TestRunCount verifies count prints a bare integer, and 0 with --quiet when no daemon runs.
+func TestRunCount(t *testing.T) {
+	original := SocketPath
+	defer func() { SocketPath = original }()
+	SocketPath = filepath.Join(t.TempDir(), "cnote.sock")
+
+	// 1. No daemon: quiet prints 0, otherwise it is an error
+	var out bytes.Buffer
+	if err := runCount(true, &out); err != nil {
+		t.Fatalf("runCount failed: %v", err)
+	}
+	if out.String() != "0\n" {
+		t.Errorf("Expected '0', got %q", out.String())
+	}
+	if err := runCount(false, &out); err != errNoSession {
+		t.Errorf("Expected errNoSession, got %v", err)
+	}
+
+	// 2. A running daemon reports its count
+	service := setupTestService()
+	service.Add(AddArgs{Text: "A"}, &NoteReply{})
+	service.Add(AddArgs{Text: "B"}, &NoteReply{})
+	server, l, err := listenDaemon(service, SocketPath)
+	if err != nil {
+		t.Fatalf("listenDaemon failed: %v", err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+
+	out.Reset()
+	if err := runCount(true, &out); err != nil {
+		t.Fatalf("runCount failed: %v", err)
+	}
+	if out.String() != "2\n" {
+		t.Errorf("Expected '2', got %q", out.String())
+	}
+}
+
+// TestOpenOutput verifies --output selects stdout by default and otherwise truncates the named file.
+func TestOpenOutput(t *testing.T) {
+	w, closeOut, err := openOutput("")
+	if err != nil || w != os.Stdout {
+		t.Fatalf("Expected stdout for an empty path, got %v (err %v)", w, err)
+	}
+	if err := closeOut(); err != nil {
+		t.Errorf("Closing stdout output failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("old contents that are longer"), 0o644)
+	w, closeOut, err = openOutput(path)
+	if err != nil {
+		t.Fatalf("openOutput failed: %v", err)
+	}
+	fmt.Fprintln(w, "ID  CONTENT")
+	if err := closeOut(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "ID  CONTENT\n" {
+		t.Errorf("Expected the file to be truncated and rewritten, got %q", data)
+	}
+
+	if _, _, err := openOutput(filepath.Join(t.TempDir(), "missing", "notes.txt")); err == nil {
+		t.Error("Expected an error for an unwritable path")
+	}
+}
+
+// TestListCountOnlyFiltered verifies the count-only path counts just the notes matching --pinned.
+func TestListCountOnlyFiltered(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A", Pinned: true}, &NoteReply{})
+	s.Add(AddArgs{Text: "B"}, &NoteReply{})
+	s.Add(AddArgs{Text: "C", Pinned: true}, &NoteReply{})
+
+	pinned := true
+	filter := ListFilter{Pinned: &pinned}
+
+	// Filtered by the daemon (list)
+	var reply ListReply
+	s.List(filter, &reply)
+	if len(reply.Notes) != 2 {
+		t.Errorf("Expected 2 pinned notes from List, got %d", len(reply.Notes))
+	}
+
+	// Filtered client-side (list --since-last)
+	s.Since(SinceArgs{}, &reply)
+	if got := applyFilter(reply.Notes, filter); !equalIDs(noteIDs(got), []int{1, 3}) {
+		t.Errorf("Expected pinned notes [1 3], got %v", noteIDs(got))
+	}
+}
+
+// TestDecorate verifies --prefix and --suffix wrap the text and are no-ops when empty.
+func TestDecorate(t *testing.T) {
+	tests := []struct {
+		prefix, suffix, expected string
+	}{
+		{"", "", "meeting"},
+		{"[cal] ", "", "[cal] meeting"},
+		{"", " (room 4)", "meeting (room 4)"},
+		{"[cal] ", " (room 4)", "[cal] meeting (room 4)"},
+	}
+	for _, tt := range tests {
+		if got := decorate("meeting", tt.prefix, tt.suffix); got != tt.expected {
+			t.Errorf("decorate(%q, %q): expected %q, got %q", tt.prefix, tt.suffix, tt.expected, got)
+		}
+	}
+}
+
+// TestSplitLines verifies stdin is split into trimmed notes with blank lines skipped.
+func TestSplitLines(t *testing.T) {
+	got := splitLines("  buy milk \n\n\tcall bob\r\n   \nship it")
+	expected := []string{"buy milk", "call bob", "ship it"}
+
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %q", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Line %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+
+	if lines := splitLines("\n \n"); len(lines) != 0 {
+		t.Errorf("Expected no lines from blank input, got %q", lines)
+	}
+}
+
+// TestExportSince verifies incremental exports select only newer notes and advance the cursor.
+func TestExportSince(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})
+	s.Add(AddArgs{Text: "B"}, &NoteReply{})
+
+	client := &fakeClient{handle: func(method string, args any, reply any) error {
+		if method != "NoteService.Since" {
+			t.Fatalf("Unexpected method %s", method)
+		}
+		return s.Since(args.(SinceArgs), reply.(*ListReply))
+	}}
+
+	// 1. First export from cursor 0 takes everything
+	reply, next, err := exportSince(client, 0)
+	if err != nil {
+		t.Fatalf("exportSince failed: %v", err)
+	}
+	if got := noteIDs(reply.Notes); !equalIDs(got, []int{1, 2}) || next != 2 {
+		t.Fatalf("Expected [1 2] and cursor 2, got %v and %d", got, next)
+	}
+
+	// 2. Only notes added afterwards come next time
+	s.Add(AddArgs{Text: "C"}, &NoteReply{})
+	reply, next, err = exportSince(client, next)
+	if err != nil {
+		t.Fatalf("exportSince failed: %v", err)
+	}
+	if got := noteIDs(reply.Notes); !equalIDs(got, []int{3}) || next != 3 {
+		t.Fatalf("Expected [3] and cursor 3, got %v and %d", got, next)
+	}
+
+	// 3. Nothing new leaves the cursor where it was
+	reply, next, err = exportSince(client, next)
+	if err != nil {
+		t.Fatalf("exportSince failed: %v", err)
+	}
+	if len(reply.Notes) != 0 || next != 3 {
+		t.Errorf("Expected no notes and cursor 3, got %v and %d", noteIDs(reply.Notes), next)
+	}
+}
+
+// TestSyncOps verifies which lines a file change adds and removes.
+func TestSyncOps(t *testing.T) {
+	tests := []struct {
+		name         string
+		old, current []string
+		add, remove  []string
+	}{
+		{"first read", nil, []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"unchanged", []string{"a", "b"}, []string{"a", "b"}, nil, nil},
+		{"edited line", []string{"a", "b", "c"}, []string{"a", "B", "c"}, []string{"B"}, []string{"b"}},
+		{"reordered", []string{"a", "b"}, []string{"b", "a"}, nil, nil},
+		{"duplicate added", []string{"a"}, []string{"a", "a"}, []string{"a"}, nil},
+		{"one duplicate removed", []string{"a", "b", "a"}, []string{"b", "a"}, nil, []string{"a"}},
+		{"emptied", []string{"a", "b"}, nil, nil, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		add, remove := syncOps(tt.old, tt.current)
+		if !slices.Equal(add, tt.add) || !slices.Equal(remove, tt.remove) {
+			t.Errorf("%s: expected add %v remove %v, got add %v remove %v", tt.name, tt.add, tt.remove, add, remove)
+		}
+	}
+}
+
+// TestClearStops verifies --stop/--no-stop override the CNOTE_CLEAR_STOP default.
+func TestClearStops(t *testing.T) {
+	tests := []struct {
+		env          string
+		stop, noStop bool
+		expected     bool
+	}{
+		{"", false, false, false},
+		{"1", false, false, true},
+		{"", true, false, true},
+		{"1", false, true, false},
+	}
+	for _, tt := range tests {
+		if got := clearStops(tt.env, tt.stop, tt.noStop); got != tt.expected {
+			t.Errorf("clearStops(%q, %v, %v) = %v, expected %v", tt.env, tt.stop, tt.noStop, got, tt.expected)
+		}
+	}
+}
+
+// TestRunStart verifies start reuses a running daemon and honors --no-spawn when none is running.
+func TestRunStart(t *testing.T) {
+	original := SocketPath
+	defer func() { SocketPath = original; noSpawn = false }()
+	SocketPath = filepath.Join(t.TempDir(), "cnote.sock")
+
+	// 1. No daemon and spawning disabled: an error, nothing printed
+	noSpawn = true
+	var out bytes.Buffer
+	if err := runStart(&out); err == nil || out.Len() != 0 {
+		t.Errorf("Expected an error and no output, got %v and %q", err, out.String())
+	}
+
+	// 2. A running daemon is reused, even with spawning disabled
+	server, l, err := listenDaemon(setupTestService(), SocketPath)
+	if err != nil {
+		t.Fatalf("listenDaemon failed: %v", err)
+	}
+	defer l.Close()
+	go server.Accept(l)
+	if err := runStart(&out); err != nil {
+		t.Fatalf("runStart failed: %v", err)
+	}
+	if out.String() != "Session ready.\n" {
+		t.Errorf("Expected 'Session ready.', got %q", out.String())
+	}
+}
+
+// TestMistypedCommand verifies add warns about text that names a subcommand or looks like a flag.
+func TestMistypedCommand(t *testing.T) {
+	root := &cobra.Command{Use: "cnote"}
+	root.AddCommand(&cobra.Command{Use: "remove [id]", Aliases: []string{"rm"}}, &cobra.Command{Use: "list"})
+
+	tests := []struct {
+		text string
+		warn bool
+	}{
+		{"remove", true},
+		{"rm", true},
+		{" list ", true},
+		{"-v", true},
+		{"remove the old key", false},
+		{"Remove", false},
+		{"buy milk", false},
+		{"cnote", false},
+	}
+	for _, tt := range tests {
+		if got := mistypedCommand(tt.text, root); (got != "") != tt.warn {
+			t.Errorf("mistypedCommand(%q) = %q, expected warning: %v", tt.text, got, tt.warn)
+		}
+	}
+}
+
+// TestParseMove verifies absolute positions, up/down offsets and bad arguments.
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected MoveArgs
+		wantErr  bool
+	}{
+		{[]string{"3", "1"}, MoveArgs{IDStr: "3", Position: 1}, false},
+		{[]string{"3", "up"}, MoveArgs{IDStr: "3", Offset: -1}, false},
+		{[]string{"3", "up", "2"}, MoveArgs{IDStr: "3", Offset: -2}, false},
+		{[]string{"last", "Down"}, MoveArgs{IDStr: "last", Offset: 1}, false},
+		{[]string{"3", "0"}, MoveArgs{}, true},
+		{[]string{"3", "sideways"}, MoveArgs{}, true},
+		{[]string{"3", "2", "1"}, MoveArgs{}, true},
+		{[]string{"3", "down", "-1"}, MoveArgs{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMove(tt.args)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("parseMove(%q) = %+v, %v; expected %+v (error: %v)", tt.args, got, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+// TestClipboardCommand verifies the clipboard tool preference and fallback order.
+func TestClipboardCommand(t *testing.T) {
+	// installed fakes exec.LookPath with only the given tools on PATH
+	installed := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			if slices.Contains(names, name) {
+				return "/usr/bin/" + name, nil
+			}
+			return "", fmt.Errorf("%s: not found", name)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		wayland  bool
+		tools    []string
+		expected string
+	}{
+		{"Wayland prefers wl-paste", true, []string{"xclip", "wl-paste"}, "wl-paste"},
+		{"Wayland falls back to X", true, []string{"xsel"}, "xsel"},
+		{"X prefers xclip", false, []string{"xsel", "xclip"}, "xclip"},
+		{"X ignores wl-paste", false, []string{"wl-paste", "xsel"}, "xsel"},
+	}
+	for _, tt := range tests {
+		got, err := clipboardCommand(tt.wayland, installed(tt.tools...))
+		if err != nil || got[0] != tt.expected {
+			t.Errorf("%s: expected %s, got %v (%v)", tt.name, tt.expected, got, err)
+		}
+	}
+
+	if _, err := clipboardCommand(false, installed("wl-paste")); err == nil || !strings.Contains(err.Error(), "no clipboard tool") {
+		t.Errorf("Expected a clear error when no tool is usable, got %v", err)
+	}
+}
+
+// TestFileMirrorSync verifies failed adds are never removed later, and that a
+// replaced daemon's notes are not deleted through stale IDs.
+func TestFileMirrorSync(t *testing.T) {
+	dial := func(s *NoteService) *rpc.Client {
+		path := filepath.Join(t.TempDir(), "cnote.sock")
+		server, l, err := listenDaemon(s, path)
+		if err != nil {
+			t.Fatalf("listenDaemon failed: %v", err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go server.Accept(l)
+		client, err := rpc.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+	texts := func(s *NoteService) []string {
+		var got []string
+		for _, n := range s.notes {
+			got = append(got, n.Text)
+		}
+		return got
+	}
+
+	// 1. A read-only daemon rejects the adds; deleting the line afterwards is a no-op
+	readOnly := setupTestService()
+	readOnly.readOnly = true
+	readOnly.started = time.Now()
+	client := dial(readOnly)
+	m := newFileMirror()
+	var out bytes.Buffer
+	if err := m.sync(client, []string{"a", "b"}, &out); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if len(m.lines) != 0 || !strings.Contains(out.String(), "Error:") {
+		t.Errorf("Expected no lines recorded and errors reported, got %v:\n%s", m.lines, out.String())
+	}
+	if err := m.sync(client, []string{"b"}, &out); err != nil {
+		t.Fatalf("sync after removing a line failed: %v", err)
+	}
+
+	// 2. A normal daemon gets the lines, and a removed line removes its note
+	s := setupTestService()
+	s.started = time.Now()
+	m = newFileMirror()
+	client = dial(s)
+	m.sync(client, []string{"a", "b"}, &out)
+	m.sync(client, []string{"b"}, &out)
+	if got := texts(s); !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("Expected only %q left, got %q", "b", got)
+	}
+
+	// 3. The daemon is replaced and unrelated notes reuse IDs 1 and 2
+	replaced := setupTestService()
+	replaced.started = s.started.Add(time.Second)
+	replaced.Add(AddArgs{Text: "unrelated"}, &NoteReply{})
+	replaced.Add(AddArgs{Text: "other"}, &NoteReply{})
+	client = dial(replaced)
+	if err := m.sync(client, []string{}, &out); err != nil {
+		t.Fatalf("sync against the new daemon failed: %v", err)
+	}
+	if got := texts(replaced); !slices.Equal(got, []string{"unrelated", "other"}) {
+		t.Errorf("Expected the unrelated notes to survive, got %q", got)
+	}
+	m.sync(client, []string{"c"}, &out)
+	if got := texts(replaced); !slices.Equal(got, []string{"unrelated", "other", "c"}) {
+		t.Errorf("Expected the new line mirrored into the new daemon, got %q", got)
+	}
+}
+
+// TestRunShowBadOutput verifies an unwritable --output fails before the note
+// is read, so a read-once note survives and no view is counted.
+func TestRunShowBadOutput(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "plain"}, &NoteReply{})                      // ID 1
+	s.Add(AddArgs{Text: "secret", ExpireOnRead: true}, &NoteReply{}) // ID 2
+	// Route fake RPC calls straight into the service
+	client := &fakeClient{handle: func(method string, args any, reply any) error {
+		return s.Show(args.(IDArgs), reply.(*NoteReply))
+	}}
+
+	bad := filepath.Join(t.TempDir(), "missing", "note.txt")
+	for _, id := range []string{"1", "2"} {
+		if err := runShow(client, id, showOptions{Output: bad}); err == nil {
+			t.Errorf("Expected an error for an unwritable output path showing note %s", id)
+		}
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{1, 2}) || s.notes[0].Views != 0 {
+		t.Errorf("Expected both notes untouched, got %+v", derefNotes(s.notes))
+	}
+}
+
+// TestRunShowNeighbors verifies only the note just read is reported as
+// deleted, and that burning it keeps its neighbors in the window.
+func TestRunShowNeighbors(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "A"}, &NoteReply{})                          // ID 1
+	s.Add(AddArgs{Text: "B", ExpireOnRead: true}, &NoteReply{})      // ID 2
+	s.Add(AddArgs{Text: "C"}, &NoteReply{})                          // ID 3
+	s.Add(AddArgs{Text: "secret", ExpireOnRead: true}, &NoteReply{}) // ID 4
+	s.Add(AddArgs{Text: "E"}, &NoteReply{})                          // ID 5
+	client := &fakeClient{handle: func(method string, args any, reply any) error {
+		switch method {
+		case "NoteService.List":
+			return s.List(args.(ListFilter), reply.(*ListReply))
+		case "NoteService.Show":
+			return s.Show(args.(IDArgs), reply.(*NoteReply))
+		}
+		t.Fatalf("Unexpected method %s", method)
+		return nil
+	}}
+	output := filepath.Join(t.TempDir(), "show.txt")
+	show := func(id string) string {
+		if err := runShow(client, id, showOptions{Output: output, Neighbors: true}); err != nil {
+			t.Fatalf("runShow %s failed: %v", id, err)
+		}
+		data, _ := os.ReadFile(output)
+		return string(data)
+	}
+
+	// 1. A read-once neighbor is masked and left alone
+	got := show("3")
+	if strings.Contains(got, "deleted") || !strings.Contains(got, "--- Note 2 ---") || !strings.Contains(got, hiddenText) {
+		t.Errorf("Expected note 2 as a masked, undeleted neighbor:\n%s", got)
+	}
+	if len(s.notes) != 5 {
+		t.Fatalf("Expected all notes kept, got %d", len(s.notes))
+	}
+
+	// 2. The read-once note itself is burned, but still shown with its neighbors
+	got = show("4")
+	for _, want := range []string{"--- Note 3 ---", "Content: secret\n(This note has now been deleted.)", "--- Note 5 ---"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "deleted") != 1 {
+		t.Errorf("Expected only the burned note reported as deleted:\n%s", got)
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{1, 2, 3, 5}) {
+		t.Errorf("Expected note 4 burned, got %v", got)
+	}
+}
+
+// TestRunDiff verifies diff leaves both notes untouched and refuses read-once notes.
+func TestRunDiff(t *testing.T) {
+	s := setupTestService()
+	s.Add(AddArgs{Text: "milk\neggs"}, &NoteReply{})                 // ID 1
+	s.Add(AddArgs{Text: "milk\nbutter"}, &NoteReply{})               // ID 2
+	s.Add(AddArgs{Text: "secret", ExpireOnRead: true}, &NoteReply{}) // ID 3
+	client := &fakeClient{handle: func(method string, args any, reply any) error {
+		if method != "NoteService.Get" {
+			t.Fatalf("Unexpected method %s", method)
+		}
+		return s.Get(args.(IDArgs), reply.(*NoteReply))
+	}}
+
+	var out bytes.Buffer
+	if err := runDiff(client, "1", "2", false, &out); err != nil {
+		t.Fatalf("runDiff failed: %v", err)
+	}
+	if want := "--- Note 1\n+++ Note 2\n  milk\n- eggs\n+ butter\n"; out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+
+	for _, pair := range [][2]string{{"1", "3"}, {"3", "3"}} {
+		if err := runDiff(client, pair[0], pair[1], false, &out); err == nil || !strings.Contains(err.Error(), "read once") {
+			t.Errorf("diff %v: expected a read-once error, got %v", pair, err)
+		}
+	}
+	if got := noteIDs(derefNotes(s.notes)); !equalIDs(got, []int{1, 2, 3}) {
+		t.Errorf("Expected no note burned, got %v", got)
+	}
+	for _, n := range s.notes {
+		if n.Views != 0 {
+			t.Errorf("Expected no views counted, note %d has %d", n.ID, n.Views)
+		}
+	}
+}
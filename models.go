@@ -6,16 +6,75 @@ import (
 
 // Note represents a single casual note entry.
 type Note struct {
-	ID        int       `json:"id"`         // Incremental ID
-	Text      string    `json:"text"`       // The content of the note
-	Pinned    bool      `json:"pinned"`     // Visual priority status
-	CreatedAt time.Time `json:"created_at"` // Timestamp of creation
+	ID           int        `json:"id"`                       // Incremental ID
+	Text         string     `json:"text"`                     // The content of the note
+	Pinned       bool       `json:"pinned"`                   // Visual priority status
+	CreatedAt    time.Time  `json:"created_at"`               // Timestamp of creation
+	UpdatedAt    time.Time  `json:"updated_at"`               // Last change to text, pin state or links
+	Links        []int      `json:"links,omitempty"`          // IDs of related notes
+	Source       string     `json:"source"`                   // How the note was added: cli, stdin, ...
+	PinReason    string     `json:"pin_reason,omitempty"`     // Why the note was pinned, if given
+	PinnedAt     *time.Time `json:"pinned_at,omitempty"`      // When the note was last pinned
+	Format       string     `json:"format,omitempty"`         // Body format: "" for plain text, or "json"
+	ExpireOnRead bool       `json:"expire_on_read,omitempty"` // Deleted by the first show; text hidden elsewhere
+	Views        int        `json:"views"`                    // How many times the note was shown
 }
 
 // AddArgs represents arguments for adding a note.
 type AddArgs struct {
-	Text   string
-	Pinned bool
+	ID           int // Requested ID; zero means the next free one
+	Text         string
+	Pinned       bool
+	Top          bool   // Pin the note and insert it at the front of the list
+	Source       string // Origin of the note ("cli" if empty)
+	Format       string // "json" requires the text to be valid JSON
+	ExpireOnRead bool   // Burn after reading: the first Show deletes the note
+	LinkLast     bool   // Link the new note to the current last note, if there is one
+
+	DedupeWindow   time.Duration // Drop the add if identical text was added within this window
+	IdempotencyKey string        // A repeated add with the same key returns the existing note
+}
+
+// PinArgs represents arguments for pinning a note.
+type PinArgs struct {
+	IDStr     string
+	Exclusive bool   // Unpin every other note in the same operation
+	Reason    string // Optional annotation explaining the pin
+	ToTop     bool   // Also move the note to the front of the list, like add --pin-top
+}
+
+// MoveArgs repositions a note in the session's stored order.
+// A non-zero Position (1-based) is absolute; otherwise the note moves by
+// Offset places (negative is towards the front). Out-of-range targets clamp to the ends.
+type MoveArgs struct {
+	IDStr    string
+	Position int
+	Offset   int
+}
+
+// BoolArgs carries a single on/off value.
+type BoolArgs struct {
+	Value bool
+}
+
+// EditArgs represents arguments for replacing a note's text.
+type EditArgs struct {
+	IDStr string
+	Text  string
+
+	ExpectedUpdatedAt time.Time // If set, the edit fails unless the note is still at this version
+	Append            bool      // Add Text after the existing text instead of replacing it
+	Prepend           bool      // Add Text before the existing text instead of replacing it
+}
+
+// RestoreArgs carries a full set of notes that replaces the session's contents.
+type RestoreArgs struct {
+	Notes []Note
+}
+
+// AddManyArgs represents a batch of notes added under a single lock.
+type AddManyArgs struct {
+	Items []AddArgs
 }
 
 // IDArgs represents arguments for commands targeting a specific note.
@@ -24,9 +83,59 @@ type IDArgs struct {
 	IDStr string
 }
 
-// EmptyArgs is used for commands that require no input (like List or Clear).
+// ListFilter narrows the notes returned by List.
+// Zero-valued fields are ignored; all set fields must match (AND semantics).
+type ListFilter struct {
+	Pinned        *bool     // Only notes with this pin state (if set)
+	Text          string    // Case-insensitive substring the text must contain
+	CreatedAfter  time.Time // Only notes created after this instant
+	CreatedBefore time.Time // Only notes created before this instant
+}
+
+// SinceArgs selects notes added after a given ID.
+type SinceArgs struct {
+	ID int // Notes with an ID greater than this are returned
+}
+
+// SearchArgs represents a text query over notes.
+type SearchArgs struct {
+	Query string
+	Fuzzy bool // Match query characters in order (not necessarily adjacent) and rank results
+}
+
+// MatchArgs selects notes by their text for bulk operations.
+type MatchArgs struct {
+	Pattern string // Case-insensitive substring, or a regular expression if Regex is set
+	Regex   bool
+	DryRun  bool // Report what would be affected without changing anything
+}
+
+// DurationArgs selects notes by age.
+type DurationArgs struct {
+	Age           time.Duration // Notes created longer ago than this are selected
+	IncludePinned bool          // Pinned notes are skipped unless this is set
+}
+
+// LinkArgs identifies two notes to relate (or unrelate).
+// Both accept the same selectors as IDArgs.
+type LinkArgs struct {
+	FromStr string
+	ToStr   string
+}
+
+// TitleArgs sets the session title. An empty Title clears it.
+type TitleArgs struct {
+	Title string
+}
+
+// EmptyArgs is used for commands that require no input (like Clear).
 type EmptyArgs struct{}
 
+// ClearArgs controls what Clear does once the list is empty.
+type ClearArgs struct {
+	Stop bool // Shut the daemon down as well, instead of keeping it for reuse
+}
+
 // NoteReply is the standard response for single-note operations.
 type NoteReply struct {
 	Note    *Note  // The note object (if applicable)
@@ -34,8 +143,39 @@ type NoteReply struct {
 	Error   string // Error message (if any)
 }
 
+// CountReply is the response for bulk operations.
+type CountReply struct {
+	Count   int    // Number of notes affected
+	Notes   []Note // The affected notes (used for dry-run previews)
+	Message string // Human-readable success message
+}
+
 // ListReply is the response for the List command.
 type ListReply struct {
 	Notes []Note // Slice of all active notes
+	Title string // Session title (if set)
 	Error string
 }
+
+// TitleReply is the response for GetTitle.
+type TitleReply struct {
+	Title string
+}
+
+// StatsReply summarizes the current session.
+type StatsReply struct {
+	Total  int        `json:"total"`            // Number of notes
+	Pinned int        `json:"pinned"`           // Number of pinned notes
+	Oldest *time.Time `json:"oldest,omitempty"` // Creation time of the oldest note
+	Newest *time.Time `json:"newest,omitempty"` // Creation time of the newest note
+
+	MemBytes  uint64 `json:"mem_bytes"`  // Heap held by the daemon process
+	NoteBytes int    `json:"note_bytes"` // Bytes of note text stored
+}
+
+// HealthReply is the response for Health.
+type HealthReply struct {
+	PID       int       // Daemon process ID
+	StartedAt time.Time // When the daemon started
+	Notes     int       // Number of notes held
+}
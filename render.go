@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+)
+
+// orderNotes arranges notes for display: pinned ones first, most recently
+// pinned on top, then the rest in insertion order. If reverse is true, the
+// resulting order is flipped.
+func orderNotes(notes []Note, reverse bool) {
+	// Stable sort keeps insertion order among unpinned notes
+	sort.SliceStable(notes, func(i, j int) bool {
+		a, b := notes[i], notes[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		return a.Pinned && pinTime(a).After(pinTime(b))
+	})
+
+	if reverse {
+		for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+			notes[i], notes[j] = notes[j], notes[i]
+		}
+	}
+}
+
+// sortByViews orders notes from most to least viewed, keeping the existing
+// order among notes with the same count.
+func sortByViews(notes []Note) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].Views > notes[j].Views
+	})
+}
+
+// scoreHalfLife is how long a note takes to lose half its recency score.
+const scoreHalfLife = 24 * time.Hour
+
+// score rates how "hot" a note is at now: recency decays from 1 toward 0
+// with a half-life of scoreHalfLife, and pinning adds 1, so a pinned note
+// always outranks an unpinned one but fresh pins still beat stale ones.
+func score(n Note, now time.Time) float64 {
+	s := math.Pow(0.5, float64(noteAge(&n, now))/float64(scoreHalfLife))
+	if n.Pinned {
+		s++
+	}
+	return s
+}
+
+// sortByScore orders notes from highest to lowest score at now, keeping the
+// existing order among ties.
+func sortByScore(notes []Note, now time.Time) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		return score(notes[i], now) > score(notes[j], now)
+	})
+}
+
+// pinTime returns when a note was pinned, or the zero time if unknown.
+func pinTime(n Note) time.Time {
+	if n.PinnedAt == nil {
+		return time.Time{}
+	}
+	return *n.PinnedAt
+}
+
+// successMessage returns what a command prints after op (add, remove, pin
+// or unpin) succeeds. CNOTE_MSG_<OP>, e.g. CNOTE_MSG_ADD="Saved #{id}",
+// overrides the daemon's wording; otherwise its message is used as is.
+func successMessage(op string, reply NoteReply) string {
+	tmpl := os.Getenv("CNOTE_MSG_" + strings.ToUpper(op))
+	if tmpl == "" || reply.Note == nil {
+		return reply.Message
+	}
+	return renderMessage(tmpl, reply.Note)
+}
+
+// renderMessage fills the {id} and {text} placeholders of a message template.
+// The text is sanitized, since messages always go to the terminal, and
+// masked for read-once notes, whose text only show may reveal.
+func renderMessage(tmpl string, n *Note) string {
+	return strings.NewReplacer("{id}", strconv.Itoa(n.ID), "{text}", sanitizeText(visibleText(n))).Replace(tmpl)
+}
+
+// addOutput chooses what "add" prints. With tee, the stored text is passed
+// through (for pipelines) and the success message is suppressed; with
+// printID only the note's ID is printed, for capturing in a shell variable.
+func addOutput(reply NoteReply, tee, printID bool) string {
+	if printID && reply.Note != nil {
+		return strconv.Itoa(reply.Note.ID)
+	}
+	if tee && reply.Note != nil {
+		return reply.Note.Text
+	}
+	return successMessage("add", reply)
+}
+
+// detailOptions tweaks the detailed view of a note.
+type detailOptions struct {
+	ShowAge bool      // Include an "Age:" line
+	Now     time.Time // Reference time for the age
+
+	Markdown bool // Render the content as markdown with ANSI styles
+	Raw      bool // Print the content as stored, without sanitizeText
+	Burned   bool // This read deleted the note, so say so
+}
+
+// printTitle writes the session title as a heading, if there is one.
+func printTitle(w io.Writer, title string) {
+	if title != "" {
+		fmt.Fprintf(w, "== %s ==\n", sanitizeText(title))
+	}
+}
+
+// defaultPinMarker marks pinned notes in the table's PINNED column.
+const defaultPinMarker = "Yes"
+
+// pinMarker returns the configured pin marker. CNOTE_PIN_MARKER overrides
+// the default with any string; setting it empty hides the PINNED column.
+func pinMarker() string {
+	if m, ok := os.LookupEnv("CNOTE_PIN_MARKER"); ok {
+		return m
+	}
+	return defaultPinMarker
+}
+
+// tableOptions selects optional columns for printNoteTable.
+type tableOptions struct {
+	Wide       bool     // Add the PINNED and CREATED columns
+	ShowSource bool     // Add a SOURCE column
+	PinMarker  string   // Text marking pinned notes; empty drops the PINNED column
+	NoHeader   bool     // Omit the header and separator rows
+	Columns    []string // Exact columns by name, in order; overrides Wide and ShowSource
+
+	Raw bool // Print note text as stored, without sanitizeText
+}
+
+// tableColumn is one column of the note table.
+type tableColumn struct {
+	Header string
+	Value  func(n Note) string
+}
+
+// columnNames lists the names accepted by "list --columns".
+var columnNames = []string{"id", "pinned", "created", "source", "views", "text"}
+
+// column returns the table column with the given name (one of columnNames).
+func column(name string, opts tableOptions) tableColumn {
+	switch name {
+	case "id":
+		return tableColumn{"ID", func(n Note) string { return strconv.Itoa(n.ID) }}
+	case "pinned":
+		return tableColumn{"PINNED", func(n Note) string {
+			if n.Pinned {
+				return opts.PinMarker
+			}
+			return ""
+		}}
+	case "created":
+		return tableColumn{"CREATED", func(n Note) string { return n.CreatedAt.Format("03:04PM") }}
+	case "source":
+		return tableColumn{"SOURCE", func(n Note) string { return n.Source }}
+	case "views":
+		return tableColumn{"VIEWS", func(n Note) string { return strconv.Itoa(n.Views) }}
+	default:
+		return tableColumn{"CONTENT", func(n Note) string {
+			if opts.Raw {
+				return n.Text
+			}
+			return sanitizeText(n.Text)
+		}}
+	}
+}
+
+// parseColumns splits a comma-separated --columns value, rejecting unknown names.
+func parseColumns(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(columnNames, name) {
+			return nil, fmt.Errorf("unknown column %q (valid: %s)", name, strings.Join(columnNames, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// tableColumns picks the columns for a table. The compact default is just
+// ID and content; Wide and ShowSource add columns in between.
+func tableColumns(opts tableOptions) []tableColumn {
+	names := opts.Columns
+	if names == nil {
+		names = []string{"id"}
+		if opts.Wide && opts.PinMarker != "" {
+			names = append(names, "pinned")
+		}
+		if opts.Wide {
+			names = append(names, "created")
+		}
+		if opts.ShowSource {
+			names = append(names, "source")
+		}
+		names = append(names, "text")
+	}
+
+	cols := make([]tableColumn, len(names))
+	for i, name := range names {
+		cols[i] = column(name, opts)
+	}
+	return cols
+}
+
+// printNoteTable writes notes as aligned columns, in the order given.
+func printNoteTable(out io.Writer, notes []Note, opts tableOptions) {
+	cols := tableColumns(opts)
+	headers := make([]string, len(cols))
+	rules := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.Header
+		rules[i] = strings.Repeat("-", len(c.Header))
+	}
+
+	// Tabwriter for clean columns
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if !opts.NoHeader {
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+		fmt.Fprintln(w, strings.Join(rules, "\t"))
+	}
+	row := make([]string, len(cols))
+	for _, n := range notes {
+		for i, c := range cols {
+			row[i] = c.Value(n)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// writeNotesCSV writes notes as CSV with a header row.
+// encoding/csv quotes text containing commas, quotes, or newlines.
+func writeNotesCSV(out io.Writer, notes []Note) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"id", "pinned", "created_at", "text"})
+	for _, n := range notes {
+		w.Write([]string{
+			strconv.Itoa(n.ID),
+			strconv.FormatBool(n.Pinned),
+			n.CreatedAt.Format(time.RFC3339),
+			n.Text,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeNotesNDJSON writes one compact JSON object per note, each on its own
+// line, for streaming consumers. No notes means no output at all.
+func writeNotesNDJSON(w io.Writer, notes []Note) error {
+	enc := json.NewEncoder(w) // Encode ends each value with a newline
+	for _, n := range notes {
+		if err := enc.Encode(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printNoteDetails writes the detailed, multi-line view of a single note.
+func printNoteDetails(w io.Writer, n *Note, opts detailOptions) {
+	fmt.Fprintf(w, "--- Note %d ---\n", n.ID)
+	fmt.Fprintf(w, "Pinned:  %s\n", map[bool]string{true: "Yes", false: "No"}[n.Pinned])
+	if n.PinReason != "" {
+		fmt.Fprintf(w, "Reason:  %s\n", sanitizeText(n.PinReason))
+	}
+	fmt.Fprintf(w, "Created: %s\n", n.CreatedAt.Format("03:04PM"))
+	fmt.Fprintf(w, "Views:   %d\n", n.Views)
+	if opts.ShowAge {
+		fmt.Fprintf(w, "Age:     %s\n", formatAge(noteAge(n, opts.Now)))
+	}
+	if n.Format != "" {
+		fmt.Fprintf(w, "Format:  %s\n", n.Format)
+	}
+	text := n.Text
+	if !opts.Raw {
+		text = sanitizeText(text)
+	}
+	if opts.Markdown {
+		fmt.Fprintf(w, "Content:\n%s\n", renderMarkdown(text))
+	} else {
+		fmt.Fprintf(w, "Content: %s\n", text)
+	}
+	if opts.Burned {
+		fmt.Fprintln(w, "(This note has now been deleted.)")
+	}
+	if len(n.Links) > 0 {
+		related := make([]string, len(n.Links))
+		for i, id := range n.Links {
+			related[i] = strconv.Itoa(id)
+		}
+		fmt.Fprintf(w, "Related: %s\n", strings.Join(related, ", "))
+	}
+}
+
+// ANSI styles used by renderMarkdown and highlight.
+const (
+	ansiBold     = "\x1b[1m"
+	ansiNoBold   = "\x1b[22m"
+	ansiItalic   = "\x1b[3m"
+	ansiNoItalic = "\x1b[23m"
+	ansiCode     = "\x1b[36m"
+	ansiNoCode   = "\x1b[39m"
+	ansiHeading  = "\x1b[1;4m"
+	ansiResetAll = "\x1b[0m"
+	ansiMatch    = "\x1b[1;31m"
+)
+
+// markdownBullet replaces the marker of a markdown list item.
+const markdownBullet = "•"
+
+var (
+	mdHeading = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	mdBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdCode    = regexp.MustCompile("`([^`]+)`")
+	mdBold    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdItalic  = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+)
+
+// renderMarkdown styles a small subset of markdown for the terminal:
+// headings, bullet lists, **bold**, *italic* and `code`. Anything else,
+// including numbered lists, passes through unchanged.
+func renderMarkdown(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			lines[i] = ansiHeading + m[1] + ansiResetAll
+			continue
+		}
+		if m := mdBullet.FindStringSubmatch(line); m != nil {
+			line = m[1] + markdownBullet + " " + m[2]
+		}
+		lines[i] = renderInline(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderInline applies the inline markdown styles to one line.
+func renderInline(line string) string {
+	line = mdCode.ReplaceAllString(line, ansiCode+"$1"+ansiNoCode)
+	line = mdBold.ReplaceAllString(line, ansiBold+"$1$2"+ansiNoBold)
+	return mdItalic.ReplaceAllString(line, ansiItalic+"$1"+ansiNoItalic)
+}
+
+// ansiSequence matches terminal escape sequences: CSI (colors, cursor
+// movement), OSC (titles, hyperlinks) and two-byte escapes.
+var ansiSequence = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-_])`)
+
+// sanitizeText makes note text safe to print to a terminal: escape sequences
+// (e.g. colors pasted from other output) are stripped, and any other control
+// character except newline and tab is shown escaped, like \x07.
+func sanitizeText(text string) string {
+	text = ansiSequence.ReplaceAllString(text, "")
+	var b strings.Builder
+	for _, r := range text {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			fmt.Fprintf(&b, "\\x%02x", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// highlight wraps every non-empty match of re in text with the match color.
+func highlight(text string, re *regexp.Regexp) string {
+	return re.ReplaceAllStringFunc(text, func(m string) string {
+		if m == "" {
+			return m
+		}
+		return ansiMatch + m + ansiResetAll
+	})
+}
+
+// queryPattern matches a search query the way Search does: as a literal,
+// case-insensitive substring.
+func queryPattern(query string) *regexp.Regexp {
+	return regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+}
+
+// isTerminal reports whether w is an interactive terminal, the only place
+// ANSI styling makes sense.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// neighborWindow returns the note with the given ID together with the notes
+// directly before and after it in notes. At either end there is only one
+// neighbor; nil means the ID is not present.
+func neighborWindow(notes []Note, id int) []Note {
+	for i, n := range notes {
+		if n.ID == id {
+			return notes[max(i-1, 0):min(i+2, len(notes))]
+		}
+	}
+	return nil
+}
+
+// noteFields maps each field name accepted by "show --field" to its value.
+// Names match the JSON keys; times use RFC 3339 like the CSV output.
+var noteFields = map[string]func(n *Note) string{
+	"id":         func(n *Note) string { return strconv.Itoa(n.ID) },
+	"text":       func(n *Note) string { return n.Text },
+	"pinned":     func(n *Note) string { return strconv.FormatBool(n.Pinned) },
+	"created_at": func(n *Note) string { return n.CreatedAt.Format(time.RFC3339) },
+	"updated_at": func(n *Note) string { return n.UpdatedAt.Format(time.RFC3339Nano) }, // Exact, for edit --expect-updated
+	"pinned_at": func(n *Note) string {
+		if n.PinnedAt == nil {
+			return ""
+		}
+		return n.PinnedAt.Format(time.RFC3339)
+	},
+	"pin_reason": func(n *Note) string { return n.PinReason },
+	"source":     func(n *Note) string { return n.Source },
+	"format":     func(n *Note) string { return n.Format },
+	"views":      func(n *Note) string { return strconv.Itoa(n.Views) },
+	"links": func(n *Note) string {
+		ids := make([]string, len(n.Links))
+		for i, id := range n.Links {
+			ids[i] = strconv.Itoa(id)
+		}
+		return strings.Join(ids, ",")
+	},
+}
+
+// noteField returns a single field of a note, or an error listing the valid names.
+func noteField(n *Note, name string) (string, error) {
+	get, ok := noteFields[name]
+	if !ok {
+		names := make([]string, 0, len(noteFields))
+		for k := range noteFields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown field %q (valid: %s)", name, strings.Join(names, ", "))
+	}
+	return get(n), nil
+}
+
+// printStats writes the human-readable session statistics.
+func printStats(w io.Writer, st StatsReply) {
+	fmt.Fprintf(w, "Notes:   %d\n", st.Total)
+	fmt.Fprintf(w, "Pinned:  %d\n", st.Pinned)
+	if st.Oldest != nil {
+		fmt.Fprintf(w, "Oldest:  %s\n", st.Oldest.Format("03:04PM"))
+		fmt.Fprintf(w, "Newest:  %s\n", st.Newest.Format("03:04PM"))
+	}
+	fmt.Fprintf(w, "Memory:  %s heap, %s of note text\n", formatBytes(st.MemBytes), formatBytes(uint64(st.NoteBytes)))
+}
+
+// formatBytes renders a byte count with a binary unit (B, KiB, MiB, ...).
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// noteAge returns how long ago the note was created, relative to now.
+func noteAge(n *Note, now time.Time) time.Duration {
+	age := now.Sub(n.CreatedAt)
+	if age < 0 {
+		return 0 // Clock skew; never report a negative age
+	}
+	return age
+}
+
+// formatAge renders a duration compactly: whole seconds under a minute,
+// otherwise hours and minutes (e.g. "45s", "2h13m").
+func formatAge(d time.Duration) string {
+	if d < time.Minute {
+		return d.Truncate(time.Second).String()
+	}
+	return strings.TrimSuffix(d.Truncate(time.Minute).String(), "0s")
+}
+
+// printPreview lists the notes a dry run would affect, one per line.
+func printPreview(w io.Writer, notes []Note) {
+	for _, n := range notes {
+		fmt.Fprintf(w, "  %d  %s\n", n.ID, sanitizeText(n.Text))
+	}
+}
+
+// writePreviewJSON writes a dry-run preview as a JSON array of the notes that
+// would be affected: an empty array, not null, when nothing matches.
+func writePreviewJSON(w io.Writer, notes []Note) error {
+	if notes == nil {
+		notes = []Note{}
+	}
+	return writeJSON(w, notes)
+}
+
+// htmlReport is the template for "export --format html". html/template
+// escapes the note text, so notes cannot inject markup.
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{with .Title}}{{.}}{{else}}cnote{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.text { white-space: pre-wrap; }
+tr.pinned { background: #fff3b0; font-weight: bold; }
+</style>
+</head>
+<body>
+{{with .Title}}<h1>{{.}}</h1>
+{{end}}<table>
+<tr><th>ID</th><th>Created</th><th>Note</th></tr>
+{{range .Notes}}<tr{{if .Pinned}} class="pinned"{{end}}><td>{{.ID}}</td><td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td class="text">{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeNotesHTML renders notes as a standalone HTML page, highlighting pinned ones.
+func writeNotesHTML(w io.Writer, title string, notes []Note) error {
+	return htmlReport.Execute(w, struct {
+		Title string
+		Notes []Note
+	}{title, notes})
+}
+
+// schemaVersion is the version of the JSON written by "list" and "export".
+// Bump it whenever the shape of a note changes incompatibly.
+const schemaVersion = 1
+
+// noteEnvelope wraps JSON note lists so consumers can detect format changes.
+type noteEnvelope struct {
+	SchemaVersion int    `json:"schema_version"`
+	Notes         []Note `json:"notes"`
+}
+
+// writeNotesJSON writes notes wrapped in a noteEnvelope, or as a bare array.
+func writeNotesJSON(w io.Writer, notes []Note, bare bool) error {
+	if notes == nil {
+		notes = []Note{} // An empty list, not null
+	}
+	if bare {
+		return writeJSON(w, notes)
+	}
+	return writeJSON(w, noteEnvelope{SchemaVersion: schemaVersion, Notes: notes})
+}
+
+// writeExport renders a session snapshot in the given format: json or html.
+// JSON keeps the daemon's own order, which restore-file needs to reproduce
+// the list exactly; the HTML report is ordered like "list". bare drops the
+// JSON envelope.
+func writeExport(w io.Writer, format string, list ListReply, bare bool) error {
+	switch format {
+	case "json":
+		return writeNotesJSON(w, list.Notes, bare)
+	case "html":
+		notes := slices.Clone(list.Notes)
+		orderNotes(notes, false)
+		return writeNotesHTML(w, list.Title, notes)
+	default:
+		return fmt.Errorf("unknown format %q (use json or html)", format)
+	}
+}
+
+// readExport parses notes written by "export --format json", with or
+// without the envelope, refusing files from a newer schema.
+func readExport(r io.Reader) ([]Note, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("not a cnote JSON export: %v", err)
+	}
+
+	var notes []Note
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		// A bare array, as written by --bare and by older versions
+		if err := json.Unmarshal(raw, &notes); err != nil {
+			return nil, fmt.Errorf("not a cnote JSON export: %v", err)
+		}
+		return notes, nil
+	}
+
+	var env noteEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("not a cnote JSON export: %v", err)
+	}
+	if env.SchemaVersion == 0 {
+		return nil, fmt.Errorf("not a cnote JSON export: missing schema_version")
+	}
+	if env.SchemaVersion > schemaVersion {
+		return nil, fmt.Errorf("export uses schema version %d, but this cnote only reads up to %d", env.SchemaVersion, schemaVersion)
+	}
+	return env.Notes, nil
+}
+
+// jsonError is the shape of errors reported in JSON mode.
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes v as indented JSON followed by a newline.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// lineDiff compares two texts line by line using a longest common subsequence.
+// Each output line is prefixed with "  " (unchanged), "- " (only in a) or "+ " (only in b).
+func lineDiff(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			out = append(out, "  "+x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, "- "+x[i])
+	}
+	for ; j < len(y); j++ {
+		out = append(out, "+ "+y[j])
+	}
+	return out
+}
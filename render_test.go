@@ -0,0 +1,769 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noteIDs extracts the IDs of notes in their current order.
+func noteIDs(notes []Note) []int {
+	ids := make([]int, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+// equalIDs reports whether two ID slices match element by element.
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestOrderNotesReverse verifies --reverse flips the default (pinned-first, insertion) ordering.
+func TestOrderNotesReverse(t *testing.T) {
+	tests := []struct {
+		name     string
+		notes    []Note
+		reverse  bool
+		expected []int
+	}{
+		{"Empty", []Note{}, true, []int{}},
+		{"Single", []Note{{ID: 1}}, true, []int{1}},
+		{"Default", []Note{{ID: 1}, {ID: 2, Pinned: true}, {ID: 3}}, false, []int{2, 1, 3}},
+		{"Reversed", []Note{{ID: 1}, {ID: 2, Pinned: true}, {ID: 3}}, true, []int{3, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderNotes(tt.notes, tt.reverse)
+			if got := noteIDs(tt.notes); !equalIDs(got, tt.expected) {
+				t.Errorf("Expected order %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestTableColumns verifies which columns each list mode selects.
+func TestTableColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     tableOptions
+		expected string
+	}{
+		{"Compact", tableOptions{}, "ID CONTENT"},
+		{"Wide", tableOptions{Wide: true, PinMarker: "Yes"}, "ID PINNED CREATED CONTENT"},
+		{"CompactSource", tableOptions{ShowSource: true}, "ID SOURCE CONTENT"},
+		{"WideSource", tableOptions{Wide: true, ShowSource: true, PinMarker: "Yes"}, "ID PINNED CREATED SOURCE CONTENT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			for _, c := range tableColumns(tt.opts) {
+				headers = append(headers, c.Header)
+			}
+			if got := strings.Join(headers, " "); got != tt.expected {
+				t.Errorf("Expected columns %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// Rows follow the same columns
+	var out bytes.Buffer
+	printNoteTable(&out, []Note{{ID: 7, Text: "buy milk", Pinned: true}}, tableOptions{})
+	if out.String() != "ID  CONTENT\n--  -------\n7   buy milk\n" {
+		t.Errorf("Unexpected compact table:\n%s", out.String())
+	}
+
+	// --no-header keeps the columns but drops the header rows
+	out.Reset()
+	printNoteTable(&out, []Note{{ID: 7, Text: "buy milk"}, {ID: 10, Text: "call bob"}}, tableOptions{NoHeader: true})
+	if out.String() != "7   buy milk\n10  call bob\n" {
+		t.Errorf("Unexpected headerless table:\n%s", out.String())
+	}
+}
+
+// TestParseColumns verifies --columns keeps the requested order and rejects unknown names.
+func TestParseColumns(t *testing.T) {
+	names, err := parseColumns("text, ID,created")
+	if err != nil {
+		t.Fatalf("parseColumns failed: %v", err)
+	}
+	if strings.Join(names, ",") != "text,id,created" {
+		t.Errorf("Expected [text id created], got %v", names)
+	}
+
+	var headers []string
+	for _, c := range tableColumns(tableOptions{Columns: names, Wide: true, ShowSource: true}) {
+		headers = append(headers, c.Header)
+	}
+	if got := strings.Join(headers, " "); got != "CONTENT ID CREATED" {
+		t.Errorf("Expected explicit columns to override the defaults, got %q", got)
+	}
+
+	if _, err := parseColumns("id,tags"); err == nil || !strings.Contains(err.Error(), `"tags"`) {
+		t.Errorf("Expected an error naming the unknown column, got %v", err)
+	}
+}
+
+// TestPinMarker verifies custom markers are rendered and an empty one drops the column.
+func TestPinMarker(t *testing.T) {
+	t.Setenv("CNOTE_PIN_MARKER", "")
+	os.Unsetenv("CNOTE_PIN_MARKER") // Restored by t.Setenv when the test ends
+	if got := pinMarker(); got != defaultPinMarker {
+		t.Errorf("Expected default marker %q, got %q", defaultPinMarker, got)
+	}
+	t.Setenv("CNOTE_PIN_MARKER", "*")
+	if got := pinMarker(); got != "*" {
+		t.Errorf("Expected marker '*', got %q", got)
+	}
+	t.Setenv("CNOTE_PIN_MARKER", "")
+	if got := pinMarker(); got != "" {
+		t.Errorf("Expected empty marker, got %q", got)
+	}
+
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	notes := []Note{{ID: 1, Text: "a", Pinned: true, CreatedAt: created}, {ID: 2, Text: "b", CreatedAt: created}}
+
+	var out bytes.Buffer
+	printNoteTable(&out, notes, tableOptions{Wide: true, PinMarker: "*"})
+	expected := "ID  PINNED  CREATED  CONTENT\n" +
+		"--  ------  -------  -------\n" +
+		"1   *       09:00AM  a\n" +
+		"2           09:00AM  b\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected table with custom marker:\n%s\nwant:\n%s", out.String(), expected)
+	}
+
+	out.Reset()
+	printNoteTable(&out, notes, tableOptions{Wide: true})
+	if strings.Contains(out.String(), "PINNED") {
+		t.Errorf("Expected no PINNED column for an empty marker:\n%s", out.String())
+	}
+}
+
+// TestOrderNotesByPinTime verifies the most recently pinned note leads the pinned section.
+func TestOrderNotesByPinTime(t *testing.T) {
+	s := setupTestService()
+	for _, text := range []string{"A", "B", "C", "D"} {
+		s.Add(AddArgs{Text: text}, &NoteReply{}) // IDs 1-4
+	}
+	// Pin in the order 3, 1, 4; PinnedAt needs distinct times
+	for _, id := range []string{"3", "1", "4"} {
+		s.Pin(PinArgs{IDStr: id}, &NoteReply{})
+		time.Sleep(time.Millisecond)
+	}
+
+	notes := derefNotes(s.notes)
+	orderNotes(notes, false)
+	if got := noteIDs(notes); !equalIDs(got, []int{4, 1, 3, 2}) {
+		t.Errorf("Expected order [4 1 3 2], got %v", got)
+	}
+
+	// Re-pinning moves a note back to the top; unpinning clears its pin time
+	s.Pin(PinArgs{IDStr: "3"}, &NoteReply{})
+	s.Unpin(IDArgs{IDStr: "1"}, &NoteReply{})
+	if s.notes[0].PinnedAt != nil {
+		t.Error("Expected PinnedAt cleared on unpin")
+	}
+	notes = derefNotes(s.notes)
+	orderNotes(notes, false)
+	if got := noteIDs(notes); !equalIDs(got, []int{3, 4, 1, 2}) {
+		t.Errorf("Expected order [3 4 1 2], got %v", got)
+	}
+}
+
+// TestScore verifies recency decays by half per half-life and pinning adds a point.
+func TestScore(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	fresh := Note{ID: 1, CreatedAt: now}
+	dayOld := Note{ID: 2, CreatedAt: now.Add(-24 * time.Hour)}
+	oldPin := Note{ID: 3, CreatedAt: now.Add(-72 * time.Hour), Pinned: true}
+
+	tests := []struct {
+		n        Note
+		expected float64
+	}{
+		{fresh, 1},
+		{dayOld, 0.5},
+		{oldPin, 1.125},
+		{Note{CreatedAt: now.Add(time.Hour)}, 1}, // Clock skew counts as brand new
+	}
+	for _, tt := range tests {
+		if got := score(tt.n, now); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("score(note %d) = %v, expected %v", tt.n.ID, got, tt.expected)
+		}
+	}
+
+	notes := []Note{dayOld, fresh, oldPin}
+	sortByScore(notes, now)
+	if got := noteIDs(notes); !equalIDs(got, []int{3, 1, 2}) {
+		t.Errorf("Expected order [3 1 2], got %v", got)
+	}
+}
+
+// TestAddOutputTee verifies --tee prints the stored text instead of the message.
+func TestAddOutputTee(t *testing.T) {
+	reply := NoteReply{Note: &Note{ID: 1, Text: "build done"}, Message: "Note added (ID: 1)"}
+
+	if got := addOutput(reply, true, false); got != "build done" {
+		t.Errorf("Expected tee output 'build done', got %q", got)
+	}
+	if got := addOutput(reply, false, false); got != "Note added (ID: 1)" {
+		t.Errorf("Expected success message, got %q", got)
+	}
+}
+
+// TestSuccessMessage verifies CNOTE_MSG_* templates replace the daemon's wording for add, remove and pin.
+func TestSuccessMessage(t *testing.T) {
+	reply := func(msg string) NoteReply {
+		return NoteReply{Note: &Note{ID: 7, Text: "buy milk"}, Message: msg}
+	}
+
+	// Defaults match the daemon's messages
+	if got := successMessage("add", reply("Note added (ID: 7)")); got != "Note added (ID: 7)" {
+		t.Errorf("Expected the default message, got %q", got)
+	}
+
+	t.Setenv("CNOTE_MSG_ADD", "Saved #{id}: {text}")
+	t.Setenv("CNOTE_MSG_REMOVE", "Nota {id} eliminada")
+	t.Setenv("CNOTE_MSG_PIN", "📌 {text}")
+	tests := []struct {
+		op, expected string
+	}{
+		{"add", "Saved #7: buy milk"},
+		{"remove", "Nota 7 eliminada"},
+		{"pin", "📌 buy milk"},
+		{"unpin", "daemon message"}, // No template set
+	}
+	for _, tt := range tests {
+		if got := successMessage(tt.op, reply("daemon message")); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.op, tt.expected, got)
+		}
+	}
+	if got := addOutput(reply("Note added (ID: 7)"), false, false); got != "Saved #7: buy milk" {
+		t.Errorf("Expected add output to use the template, got %q", got)
+	}
+
+	// {text} never carries terminal escape sequences
+	colored := NoteReply{Note: &Note{ID: 7, Text: "\x1b[2Jbuy milk"}}
+	if got := successMessage("pin", colored); got != "📌 buy milk" {
+		t.Errorf("Expected sanitized text in the message, got %q", got)
+	}
+
+	// A read-once note's text stays hidden
+	once := NoteReply{Note: &Note{ID: 7, Text: "the wifi password", ExpireOnRead: true}}
+	if got := successMessage("pin", once); got != "📌 "+hiddenText {
+		t.Errorf("Expected the read-once text masked, got %q", got)
+	}
+
+	// Without a note there is nothing to fill in
+	if got := successMessage("add", NoteReply{Message: "Note added (ID: 7)"}); got != "Note added (ID: 7)" {
+		t.Errorf("Expected the daemon message without a note, got %q", got)
+	}
+}
+
+// TestAddOutputPrintID verifies --print-id prints nothing but the new ID.
+func TestAddOutputPrintID(t *testing.T) {
+	reply := NoteReply{Note: &Note{ID: 42, Text: "build done"}, Message: "Note added (ID: 42)"}
+
+	if got := addOutput(reply, false, true); got != "42" {
+		t.Errorf("Expected '42', got %q", got)
+	}
+	if got := addOutput(reply, true, true); got != "42" {
+		t.Errorf("Expected --print-id to win over --tee, got %q", got)
+	}
+}
+
+// TestNoteAge verifies the age computation and its compact rendering.
+func TestNoteAge(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	n := &Note{ID: 1, CreatedAt: created}
+
+	tests := []struct {
+		now      time.Time
+		expected string
+	}{
+		{created.Add(45*time.Second + 300*time.Millisecond), "45s"},
+		{created.Add(2*time.Hour + 13*time.Minute + 20*time.Second), "2h13m"},
+		{created.Add(5 * time.Minute), "5m"},
+		{created.Add(-time.Minute), "0s"}, // Future timestamps clamp to zero
+	}
+
+	for _, tt := range tests {
+		if got := formatAge(noteAge(n, tt.now)); got != tt.expected {
+			t.Errorf("Age at %v: expected %q, got %q", tt.now.Sub(created), tt.expected, got)
+		}
+	}
+
+	// The detailed view only includes the age when asked
+	var out bytes.Buffer
+	printNoteDetails(&out, n, detailOptions{ShowAge: true, Now: created.Add(5 * time.Minute)})
+	if !strings.Contains(out.String(), "Age:     5m\n") {
+		t.Errorf("Expected an Age line, got %q", out.String())
+	}
+	out.Reset()
+	printNoteDetails(&out, n, detailOptions{})
+	if strings.Contains(out.String(), "Age:") {
+		t.Errorf("Did not expect an Age line, got %q", out.String())
+	}
+}
+
+// TestAddJSONRendering verifies the new note is rendered as JSON with its ID and timestamp.
+func TestAddJSONRendering(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	n := &Note{ID: 4, Text: "deploy", Pinned: true, CreatedAt: created}
+
+	var out bytes.Buffer
+	if err := writeJSON(&out, n); err != nil {
+		t.Fatalf("writeJSON failed: %v", err)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, out.String())
+	}
+	if decoded["id"] != float64(4) || decoded["text"] != "deploy" || decoded["pinned"] != true {
+		t.Errorf("Unexpected JSON fields: %v", decoded)
+	}
+	if decoded["created_at"] != "2024-05-01T09:00:00Z" {
+		t.Errorf("Expected RFC 3339 created_at, got %v", decoded["created_at"])
+	}
+
+	// Errors use a single "error" field
+	out.Reset()
+	writeJSON(&out, jsonError{Error: "boom"})
+	if strings.TrimSpace(out.String()) != "{\n  \"error\": \"boom\"\n}" {
+		t.Errorf("Unexpected error JSON: %q", out.String())
+	}
+}
+
+// TestWriteNotesCSV verifies the header, field formatting, and quoting of awkward text.
+func TestWriteNotesCSV(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	notes := []Note{
+		{ID: 1, Text: "plain", CreatedAt: created},
+		{ID: 2, Text: `eggs, "free range"`, Pinned: true, CreatedAt: created},
+		{ID: 3, Text: "line one\nline two", CreatedAt: created},
+	}
+
+	var out bytes.Buffer
+	if err := writeNotesCSV(&out, notes); err != nil {
+		t.Fatalf("writeNotesCSV failed: %v", err)
+	}
+
+	expected := "id,pinned,created_at,text\n" +
+		"1,false,2024-05-01T09:00:00Z,plain\n" +
+		"2,true,2024-05-01T09:00:00Z,\"eggs, \"\"free range\"\"\"\n" +
+		"3,false,2024-05-01T09:00:00Z,\"line one\nline two\"\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", out.String(), expected)
+	}
+
+	// The output must parse back to the original text
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV does not parse: %v", err)
+	}
+	if len(records) != 4 || records[2][3] != notes[1].Text || records[3][3] != notes[2].Text {
+		t.Errorf("CSV round-trip mismatch: %q", records)
+	}
+}
+
+// TestWriteNotesNDJSON verifies each note is a complete JSON object on its own line.
+func TestWriteNotesNDJSON(t *testing.T) {
+	notes := []Note{
+		{ID: 1, Text: "line one\nline two", CreatedAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+		{ID: 4, Text: `say "hi"`, Pinned: true},
+	}
+	var buf bytes.Buffer
+	if err := writeNotesNDJSON(&buf, notes); err != nil {
+		t.Fatalf("writeNotesNDJSON failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		var n Note
+		if err := json.Unmarshal([]byte(line), &n); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v", i+1, err)
+		}
+		if n.ID != notes[i].ID || n.Text != notes[i].Text || n.Pinned != notes[i].Pinned {
+			t.Errorf("Line %d decoded to %+v, expected %+v", i+1, n, notes[i])
+		}
+	}
+
+	buf.Reset()
+	writeNotesNDJSON(&buf, nil)
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output for no notes, got %q", buf.String())
+	}
+}
+
+// TestWritePreviewJSON verifies the dry-run preview is a JSON array of notes, empty when nothing matches.
+func TestWritePreviewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writePreviewJSON(&buf, []Note{{ID: 2, Text: "old log"}, {ID: 5, Text: "log rotate"}}); err != nil {
+		t.Fatalf("writePreviewJSON failed: %v", err)
+	}
+	var notes []Note
+	if err := json.Unmarshal(buf.Bytes(), &notes); err != nil {
+		t.Fatalf("Output is not a JSON array: %v\n%s", err, buf.String())
+	}
+	if got := noteIDs(notes); !equalIDs(got, []int{2, 5}) {
+		t.Errorf("Expected IDs [2 5], got %v", got)
+	}
+
+	buf.Reset()
+	writePreviewJSON(&buf, nil)
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("Expected an empty array, got %q", buf.String())
+	}
+}
+
+// TestWriteNotesHTML verifies one row per note, pinned rows highlighted, and escaped text.
+func TestWriteNotesHTML(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	notes := []Note{
+		{ID: 1, Text: "ship <b>it</b> & relax", Pinned: true, CreatedAt: created},
+		{ID: 2, Text: `<script>alert("x")</script>`, CreatedAt: created},
+	}
+
+	var out bytes.Buffer
+	if err := writeNotesHTML(&out, "Release <day>", notes); err != nil {
+		t.Fatalf("writeNotesHTML failed: %v", err)
+	}
+	html := out.String()
+
+	for _, want := range []string{
+		"<h1>Release &lt;day&gt;</h1>",
+		`<tr class="pinned"><td>1</td><td>2024-05-01 09:00</td><td class="text">ship &lt;b&gt;it&lt;/b&gt; &amp; relax</td></tr>`,
+		`<tr><td>2</td><td>2024-05-01 09:00</td><td class="text">&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</td></tr>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected HTML to contain %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("Note text was not escaped:\n%s", html)
+	}
+
+	if err := writeExport(&out, "pdf", ListReply{}, false); err == nil {
+		t.Error("Expected an error for an unknown export format")
+	}
+}
+
+// TestRenderMarkdown verifies headings, bullets and inline styles become ANSI and plain text is untouched.
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{"## Deploy", "\x1b[1;4mDeploy\x1b[0m"},
+		{"- step one", "• step one"},
+		{"  * nested", "  • nested"},
+		{"run **now**", "run \x1b[1mnow\x1b[22m"},
+		{"an *aside*", "an \x1b[3maside\x1b[23m"},
+		{"call `make`", "call \x1b[36mmake\x1b[39m"},
+		{"1. plain text, 2 * 3", "1. plain text, 2 * 3"},
+		{"#notaheading", "#notaheading"},
+	}
+	for _, tt := range tests {
+		if got := renderMarkdown(tt.in); got != tt.expected {
+			t.Errorf("renderMarkdown(%q) = %q, expected %q", tt.in, got, tt.expected)
+		}
+	}
+
+	// Lines are rendered independently
+	if got := renderMarkdown("# A\n- **b**"); got != "\x1b[1;4mA\x1b[0m\n• \x1b[1mb\x1b[22m" {
+		t.Errorf("Unexpected multi-line rendering %q", got)
+	}
+
+	// Not a terminal: a buffer gets no styles
+	var buf bytes.Buffer
+	if isTerminal(&buf) {
+		t.Error("Expected a buffer not to be a terminal")
+	}
+}
+
+// TestSanitizeText verifies escape sequences are stripped and other control characters escaped.
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{"plain text", "plain text"},
+		{"\x1b[31mred\x1b[0m build", "red build"},
+		{"\x1b[1;38;5;208morange\x1b[m", "orange"},
+		{"\x1b[2J\x1b[Hcleared", "cleared"},                  // Clear screen and cursor home
+		{"\x1b]0;pwned\x07title", "title"},                   // OSC window title, BEL-terminated
+		{"\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"}, // OSC 8 hyperlink, ST-terminated
+		{"bell\x07 and back\bspace", "bell\\x07 and back\\x08space"},
+		{"lone \x1b", "lone \\x1b"},
+		{"keeps\ttabs\nand newlines", "keeps\ttabs\nand newlines"},
+		{"c1 \u009b31m", "c1 \\x9b31m"},
+		{"héllo 🎩", "héllo 🎩"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeText(tt.in); got != tt.expected {
+			t.Errorf("sanitizeText(%q) = %q, expected %q", tt.in, got, tt.expected)
+		}
+	}
+
+	// Tables sanitize unless Raw is set
+	notes := []Note{{ID: 1, Text: "\x1b[31mred\x1b[0m"}}
+	var buf bytes.Buffer
+	printNoteTable(&buf, notes, tableOptions{NoHeader: true})
+	if strings.Contains(buf.String(), "\x1b") {
+		t.Errorf("Expected a sanitized table, got %q", buf.String())
+	}
+	buf.Reset()
+	printNoteTable(&buf, notes, tableOptions{NoHeader: true, Raw: true})
+	if !strings.Contains(buf.String(), "\x1b[31m") {
+		t.Errorf("Expected raw text with Raw, got %q", buf.String())
+	}
+}
+
+// TestHighlight verifies each match is wrapped in the match color, case-insensitively for queries.
+func TestHighlight(t *testing.T) {
+	const on, off = "\x1b[1;31m", "\x1b[0m"
+	tests := []struct {
+		text     string
+		re       *regexp.Regexp
+		expected string
+	}{
+		{"Deploy then deploy", queryPattern("deploy"), on + "Deploy" + off + " then " + on + "deploy" + off},
+		{"cost: $5 (approx)", queryPattern("$5 ("), "cost: " + on + "$5 (" + off + "approx)"},
+		{"no match here", queryPattern("zzz"), "no match here"},
+		{"v1.2 and v10.3", regexp.MustCompile(`v\d+\.\d`), on + "v1.2" + off + " and " + on + "v10.3" + off},
+		{"abc", regexp.MustCompile(`x*`), "abc"}, // Empty matches add nothing
+	}
+	for _, tt := range tests {
+		if got := highlight(tt.text, tt.re); got != tt.expected {
+			t.Errorf("highlight(%q, %v) = %q, expected %q", tt.text, tt.re, got, tt.expected)
+		}
+	}
+}
+
+// TestNeighborWindow verifies the window around a note, including at either end of the list.
+func TestNeighborWindow(t *testing.T) {
+	notes := []Note{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+	tests := []struct {
+		name     string
+		id       int
+		expected []int
+	}{
+		{"Start", 1, []int{1, 2}},
+		{"Middle", 3, []int{2, 3, 4}},
+		{"End", 4, []int{3, 4}},
+		{"Missing", 9, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := noteIDs(neighborWindow(notes, tt.id)); !equalIDs(got, tt.expected) {
+				t.Errorf("Expected window %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if got := noteIDs(neighborWindow([]Note{{ID: 5}}, 5)); !equalIDs(got, []int{5}) {
+		t.Errorf("Expected a lone note to have no neighbors, got %v", got)
+	}
+}
+
+// TestNoteField verifies single-field extraction and the error for unknown names.
+func TestNoteField(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	n := &Note{ID: 3, Text: "ship it", Pinned: true, CreatedAt: created, Links: []int{1, 4}}
+
+	tests := map[string]string{
+		"id":         "3",
+		"text":       "ship it",
+		"pinned":     "true",
+		"created_at": "2024-05-01T09:00:00Z",
+		"pinned_at":  "",
+		"links":      "1,4",
+	}
+	for field, expected := range tests {
+		got, err := noteField(n, field)
+		if err != nil {
+			t.Errorf("Field %s: unexpected error %v", field, err)
+		} else if got != expected {
+			t.Errorf("Field %s: expected %q, got %q", field, expected, got)
+		}
+	}
+
+	_, err := noteField(n, "colour")
+	if err == nil || !strings.Contains(err.Error(), "valid: created_at, format, id,") {
+		t.Errorf("Expected an error listing the valid fields, got %v", err)
+	}
+}
+
+// TestReadExport verifies a JSON export parses back into the same notes.
+func TestReadExport(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	notes := []Note{{ID: 3, Text: "a", CreatedAt: created}, {ID: 5, Text: "b", Pinned: true, CreatedAt: created}}
+
+	var out bytes.Buffer
+	if err := writeExport(&out, "json", ListReply{Notes: notes}, false); err != nil {
+		t.Fatalf("writeExport failed: %v", err)
+	}
+	got, err := readExport(&out)
+	if err != nil {
+		t.Fatalf("readExport failed: %v", err)
+	}
+	if !equalIDs(noteIDs(got), []int{3, 5}) || !got[1].Pinned || !got[0].CreatedAt.Equal(created) {
+		t.Errorf("Round trip mismatch: %+v", got)
+	}
+
+	if _, err := readExport(strings.NewReader("<html>")); err == nil {
+		t.Error("Expected an error for a non-JSON file")
+	}
+
+	// Bare arrays from --bare (and older exports) still load; newer schemas do not
+	got, err = readExport(strings.NewReader(`[{"id": 7, "text": "old"}]`))
+	if err != nil || !equalIDs(noteIDs(got), []int{7}) {
+		t.Errorf("Expected a bare array to load, got %+v, %v", got, err)
+	}
+	if _, err := readExport(strings.NewReader(`{"schema_version": 99, "notes": []}`)); err == nil {
+		t.Error("Expected an error for a newer schema version")
+	}
+	if _, err := readExport(strings.NewReader(`{"notes": []}`)); err == nil {
+		t.Error("Expected an error for a missing schema version")
+	}
+}
+
+// TestWriteNotesJSON verifies JSON output carries a schema envelope unless bare is set.
+func TestWriteNotesJSON(t *testing.T) {
+	notes := []Note{{ID: 1, Text: "a"}, {ID: 2, Text: "b"}}
+
+	var out bytes.Buffer
+	if err := writeNotesJSON(&out, notes, false); err != nil {
+		t.Fatalf("writeNotesJSON failed: %v", err)
+	}
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal(out.Bytes(), &env); err != nil {
+		t.Fatalf("Expected a JSON object, got %q: %v", out.String(), err)
+	}
+	if len(env) != 2 || string(env["schema_version"]) != strconv.Itoa(schemaVersion) {
+		t.Errorf("Expected only schema_version %d and notes, got %s", schemaVersion, out.String())
+	}
+	var inner []Note
+	if err := json.Unmarshal(env["notes"], &inner); err != nil || !equalIDs(noteIDs(inner), []int{1, 2}) {
+		t.Errorf("Expected notes 1 and 2 in the envelope, got %s", env["notes"])
+	}
+
+	// --bare: the plain array, nothing else
+	out.Reset()
+	writeNotesJSON(&out, notes, true)
+	var bare []Note
+	if err := json.Unmarshal(out.Bytes(), &bare); err != nil || !equalIDs(noteIDs(bare), []int{1, 2}) {
+		t.Errorf("Expected a bare array of notes 1 and 2, got %q", out.String())
+	}
+
+	// No notes is an empty array, never null
+	out.Reset()
+	writeNotesJSON(&out, nil, false)
+	if !strings.Contains(out.String(), `"notes": []`) {
+		t.Errorf("Expected an empty notes array, got %q", out.String())
+	}
+}
+
+// TestFormatBytes verifies byte counts are rendered with binary units.
+func TestFormatBytes(t *testing.T) {
+	tests := map[uint64]string{0: "0 B", 512: "512 B", 1536: "1.5 KiB", 3 << 20: "3.0 MiB"}
+	for in, expected := range tests {
+		if got := formatBytes(in); got != expected {
+			t.Errorf("formatBytes(%d): expected %q, got %q", in, expected, got)
+		}
+	}
+}
+
+// TestLineDiff verifies unchanged, removed, and added lines are marked correctly.
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected []string
+	}{
+		{"Identical", "one\ntwo", "one\ntwo", []string{"  one", "  two"}},
+		{"Changed", "milk\neggs\nbread", "milk\nbutter\nbread", []string{"  milk", "- eggs", "+ butter", "  bread"}},
+		{"Appended", "a", "a\nb", []string{"  a", "+ b"}},
+		{"Removed", "a\nb\nc", "a\nc", []string{"  a", "- b", "  c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineDiff(tt.a, tt.b)
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestExportRoundTrip verifies a JSON export restored into a fresh session
+// reproduces the notes, their fields and the list ordering exactly.
+func TestExportRoundTrip(t *testing.T) {
+	s := setupTestService()
+	for _, text := range []string{"A", "B", "C", "D", "E"} {
+		s.Add(AddArgs{Text: text}, &NoteReply{})
+	}
+	s.Add(AddArgs{Text: `{"k": 1}`, Format: formatJSON}, &NoteReply{})
+	s.Pin(PinArgs{IDStr: "2", Reason: "blocker"}, &NoteReply{})
+	s.Pin(PinArgs{IDStr: "4", ToTop: true}, &NoteReply{}) // Pinned later, and moved to the front
+	s.Unpin(IDArgs{IDStr: "4"}, &NoteReply{})
+	s.Pin(PinArgs{IDStr: "5"}, &NoteReply{})
+	s.Link(LinkArgs{FromStr: "1", ToStr: "3"}, &NoteReply{})
+	s.Edit(EditArgs{IDStr: "3", Text: "C2"}, &NoteReply{})
+	s.Show(IDArgs{IDStr: "1"}, &NoteReply{})
+
+	export := func(s *NoteService) []byte {
+		var list ListReply
+		s.List(ListFilter{}, &list)
+		var buf bytes.Buffer
+		if err := writeExport(&buf, "json", list, false); err != nil {
+			t.Fatalf("writeExport failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+	before := export(s)
+
+	notes, err := readExport(bytes.NewReader(before))
+	if err != nil {
+		t.Fatalf("readExport failed: %v", err)
+	}
+	restored := setupTestService()
+	if err := restored.Restore(RestoreArgs{Notes: notes}, &CountReply{}); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if after := export(restored); !bytes.Equal(before, after) {
+		t.Errorf("Round trip changed the export:\n%s\nbecame:\n%s", before, after)
+	}
+	original, again := derefNotes(s.notes), derefNotes(restored.notes)
+	orderNotes(original, false)
+	orderNotes(again, false)
+	if !equalIDs(noteIDs(original), noteIDs(again)) {
+		t.Errorf("Expected list order %v, got %v", noteIDs(original), noteIDs(again))
+	}
+	if got := noteIDs(derefNotes(restored.notes)); !equalIDs(got, []int{4, 1, 2, 3, 5, 6}) {
+		t.Errorf("Expected stored order [4 1 2 3 5 6], got %v", got)
+	}
+}